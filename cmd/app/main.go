@@ -2,8 +2,14 @@ package main
 
 import (
 	"github.com/hiholder/geex/framework/app"
+	"os"
 )
 
 func main() {
+	// routes命令只输出路由表
+	if len(os.Args) > 1 && os.Args[1] == "routes" {
+		app.PrintRoutes(os.Stdout)
+		return
+	}
 	app.Run()
 }
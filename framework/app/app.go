@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/hiholder/geex/framework"
 	"html/template"
+	"io"
 	"log"
 	"net/http"
 	"time"
@@ -22,7 +23,8 @@ func FormatAsDate(t time.Time) string {
 	return fmt.Sprintf("%d-%02d-%02d", year, month, day)
 }
 
-func Run()  {
+// NewEngine 创建并注册好全部路由的Engine
+func NewEngine() *framework.Engine {
 	e := framework.Default()
 	e.SetFuncMap(template.FuncMap{
 		"FormatAsDate": FormatAsDate,
@@ -30,11 +32,6 @@ func Run()  {
 	// 加载模板
 	e.LoadHTMLGlob("templates/*")
 	e.Static("/assets", "./static")
-	e.Get("/assets/*filepath", func(c *framework.Context) {
-		c.JSON(http.StatusOK, framework.H{
-			"filepath": c.Param("filepath"),
-		})
-	})
 	e.Get("/hello", func(c *framework.Context) {
 		c.String(http.StatusOK, "hello %s, you're at %s\n", c.Query("name"), c.Path)
 	})
@@ -79,5 +76,16 @@ func Run()  {
 		names := []string{"geek"}
 		c.String(http.StatusOK, names[100])
 	})
+	return e
+}
+
+func Run()  {
+	e := NewEngine()
+	e.SetDebug(true)
 	e.Run(":9999")
 }
+
+// PrintRoutes 输出全部路由，不启动服务
+func PrintRoutes(w io.Writer) {
+	NewEngine().PrintRoutes(w)
+}
@@ -0,0 +1,142 @@
+package framework
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+)
+
+// 认证方式
+const (
+	AuthSchemeBasic  = "basic"
+	AuthSchemeBearer = "bearer"
+	AuthSchemeAPIKey = "apikey"
+)
+
+type principalKey struct{}
+
+// Principal 认证通过的调用方
+type Principal struct {
+	Scheme  string                 // 认证方式
+	Subject string                 // Basic为用户名，JWT为sub，API key为key对应的调用方
+	Claims  map[string]interface{} // JWT的全部claims，其他认证方式为空
+}
+
+// PrincipalFromContext 获取认证中间件保存的调用方，*Context也可以直接传入
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
+
+// Principal 当前请求认证通过的调用方，没有经过认证时返回nil
+func (c *Context) Principal() *Principal {
+	p, _ := PrincipalFromContext(c)
+	return p
+}
+
+// setPrincipal 把调用方保存到请求的context中
+func (c *Context) setPrincipal(p *Principal) {
+	c.Req = c.Req.WithContext(context.WithValue(c.Req.Context(), principalKey{}, p))
+}
+
+// unauthorized 认证失败，返回401和WWW-Authenticate
+func unauthorized(c *Context, challenge, message string) {
+	c.SetHeader("WWW-Authenticate", challenge)
+	c.Fail(http.StatusUnauthorized, message)
+}
+
+// secureCompare 常量时间比较，先做哈希避免泄露长度
+func secureCompare(given, expected string) bool {
+	g, e := sha256.Sum256([]byte(given)), sha256.Sum256([]byte(expected))
+	return subtle.ConstantTimeCompare(g[:], e[:]) == 1
+}
+
+// BasicAuthConfig HTTP Basic认证的配置
+type BasicAuthConfig struct {
+	Realm     string                                       // 默认为"Restricted"
+	Accounts  map[string]string                            // 用户名到密码的映射
+	Validator func(c *Context, user, password string) bool // 自定义校验，设置后不再使用Accounts
+}
+
+// BasicAuth 使用固定的账号进行HTTP Basic认证
+func BasicAuth(accounts map[string]string) HandlerFunc {
+	return BasicAuthWithConfig(BasicAuthConfig{Accounts: accounts})
+}
+
+// BasicAuthWithConfig HTTP Basic认证，密码使用常量时间比较
+func BasicAuthWithConfig(conf BasicAuthConfig) HandlerFunc {
+	if conf.Realm == "" {
+		conf.Realm = "Restricted"
+	}
+	if conf.Validator == nil {
+		accounts := conf.Accounts
+		conf.Validator = func(c *Context, user, password string) bool {
+			expected, ok := accounts[user]
+			// 用户不存在时同样进行一次比较，避免通过耗时判断用户是否存在
+			return secureCompare(password, expected) && ok
+		}
+	}
+	challenge := "Basic realm=" + strconv.Quote(conf.Realm) + `, charset="UTF-8"`
+	return func(c *Context) {
+		user, password, ok := c.Req.BasicAuth()
+		if !ok || !conf.Validator(c, user, password) {
+			unauthorized(c, challenge, "unauthorized")
+			return
+		}
+		c.setPrincipal(&Principal{Scheme: AuthSchemeBasic, Subject: user})
+		c.Next()
+	}
+}
+
+// APIKeyConfig API key认证的配置
+type APIKeyConfig struct {
+	Header    string                                                 // 读取key的请求头，默认为X-API-Key
+	Query     string                                                 // 读取key的查询参数，为空时不从查询参数读取
+	Keys      map[string]string                                      // key到调用方的映射
+	Validator func(c *Context, key string) (subject string, ok bool) // 自定义校验，设置后不再使用Keys
+}
+
+// APIKeyAuth 使用固定的key进行认证，keys为key到调用方的映射
+func APIKeyAuth(keys map[string]string) HandlerFunc {
+	return APIKeyAuthWithConfig(APIKeyConfig{Keys: keys})
+}
+
+// APIKeyAuthWithConfig 从请求头或查询参数中读取API key进行认证，请求头优先
+func APIKeyAuthWithConfig(conf APIKeyConfig) HandlerFunc {
+	if conf.Header == "" {
+		conf.Header = "X-API-Key"
+	}
+	if conf.Validator == nil {
+		keys := conf.Keys
+		conf.Validator = func(c *Context, key string) (string, bool) {
+			// 逐个比较，耗时与key是否存在无关
+			subject, found := "", false
+			for k, s := range keys {
+				if secureCompare(key, k) {
+					subject, found = s, true
+				}
+			}
+			return subject, found
+		}
+	}
+	challenge := "APIKey header=" + strconv.Quote(conf.Header)
+	return func(c *Context) {
+		key := c.Req.Header.Get(conf.Header)
+		if key == "" && conf.Query != "" {
+			key = c.Query(conf.Query)
+		}
+		if key == "" {
+			unauthorized(c, challenge, "missing api key")
+			return
+		}
+		subject, ok := conf.Validator(c, key)
+		if !ok {
+			unauthorized(c, challenge, "invalid api key")
+			return
+		}
+		c.setPrincipal(&Principal{Scheme: AuthSchemeAPIKey, Subject: subject})
+		c.Next()
+	}
+}
@@ -0,0 +1,200 @@
+package framework
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/hiholder/geex/framework/contract"
+	c "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// signJWT 生成测试用的token，key为[]byte、*rsa.PrivateKey或*ecdsa.PrivateKey
+func signJWT(alg, kid string, key interface{}, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	hash := sha256.Sum256([]byte(signed))
+	var sig []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		sig, _ = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, hash[:])
+	case *ecdsa.PrivateKey:
+		r, s, _ := ecdsa.Sign(rand.Reader, k, hash[:])
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func newAuthEngine(auth HandlerFunc) *Engine {
+	engine := New()
+	engine.Use(auth)
+	engine.Get("/me", func(ctx *Context) {
+		p := ctx.Principal()
+		ctx.String(http.StatusOK, "%s:%s", p.Scheme, p.Subject)
+	})
+	return engine
+}
+
+func authRequest(engine *Engine, target string, header map[string]string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	for k, v := range header {
+		r.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, r)
+	return w
+}
+
+// staticKeys 测试用的JWTKeyProvider
+type staticKeys map[string]interface{}
+
+func (k staticKeys) Key(_ context.Context, kid, alg string) (interface{}, error) {
+	return k[kid], nil
+}
+
+func TestBasicAndAPIKeyAuth(t *testing.T) {
+	c.Convey("test basic auth", t, func() {
+		engine := newAuthEngine(BasicAuthWithConfig(BasicAuthConfig{
+			Realm:    "admin",
+			Accounts: map[string]string{"geex": "secret"},
+		}))
+		w := authRequest(engine, "/me", nil)
+		c.So(w.Code, c.ShouldEqual, http.StatusUnauthorized)
+		c.So(w.Header().Get("WWW-Authenticate"), c.ShouldEqual, `Basic realm="admin", charset="UTF-8"`)
+
+		bad := base64.StdEncoding.EncodeToString([]byte("geex:wrong"))
+		w = authRequest(engine, "/me", map[string]string{"Authorization": "Basic " + bad})
+		c.So(w.Code, c.ShouldEqual, http.StatusUnauthorized)
+
+		good := base64.StdEncoding.EncodeToString([]byte("geex:secret"))
+		w = authRequest(engine, "/me", map[string]string{"Authorization": "Basic " + good})
+		c.So(w.Code, c.ShouldEqual, http.StatusOK)
+		c.So(w.Body.String(), c.ShouldEqual, "basic:geex")
+	})
+
+	c.Convey("test api key from header and query", t, func() {
+		engine := newAuthEngine(APIKeyAuthWithConfig(APIKeyConfig{
+			Query: "api_key",
+			Keys:  map[string]string{"k-123": "service-a"},
+		}))
+		w := authRequest(engine, "/me", map[string]string{"X-API-Key": "k-123"})
+		c.So(w.Body.String(), c.ShouldEqual, "apikey:service-a")
+		w = authRequest(engine, "/me?api_key=k-123", nil)
+		c.So(w.Body.String(), c.ShouldEqual, "apikey:service-a")
+		w = authRequest(engine, "/me", map[string]string{"X-API-Key": "nope"})
+		c.So(w.Code, c.ShouldEqual, http.StatusUnauthorized)
+		c.So(w.Header().Get("WWW-Authenticate"), c.ShouldStartWith, "APIKey")
+	})
+}
+
+func TestJWTAuth(t *testing.T) {
+	secret := []byte("jwt-secret")
+	exp := time.Now().Add(time.Hour).Unix()
+
+	c.Convey("test HS256 with claims validation", t, func() {
+		engine := newAuthEngine(JWTAuthWithConfig(JWTConfig{
+			Secret:   secret,
+			Issuer:   "geex",
+			Audience: "api",
+		}))
+		bearer := func(token string) map[string]string {
+			return map[string]string{"Authorization": "Bearer " + token}
+		}
+		token := signJWT(JWTAlgHS256, "", secret, map[string]interface{}{
+			"sub": "u1", "iss": "geex", "aud": []string{"web", "api"}, "exp": exp,
+		})
+		w := authRequest(engine, "/me", bearer(token))
+		c.So(w.Code, c.ShouldEqual, http.StatusOK)
+		c.So(w.Body.String(), c.ShouldEqual, "bearer:u1")
+
+		w = authRequest(engine, "/me", nil)
+		c.So(w.Header().Get("WWW-Authenticate"), c.ShouldEqual, `Bearer realm="Restricted"`)
+
+		for _, tt := range []struct {
+			claims map[string]interface{}
+			desc   string
+		}{
+			{map[string]interface{}{"sub": "u1", "iss": "geex", "aud": "api", "exp": time.Now().Add(-time.Minute).Unix()}, "token is expired"},
+			{map[string]interface{}{"sub": "u1", "iss": "other", "aud": "api", "exp": exp}, "token issuer is invalid"},
+			{map[string]interface{}{"sub": "u1", "iss": "geex", "aud": "web", "exp": exp}, "token audience is invalid"},
+		} {
+			w = authRequest(engine, "/me", bearer(signJWT(JWTAlgHS256, "", secret, tt.claims)))
+			c.So(w.Code, c.ShouldEqual, http.StatusUnauthorized)
+			c.So(w.Header().Get("WWW-Authenticate"), c.ShouldContainSubstring, `error="invalid_token"`)
+			c.So(w.Header().Get("WWW-Authenticate"), c.ShouldContainSubstring, tt.desc)
+		}
+
+		forged := signJWT(JWTAlgHS256, "", []byte("other"), map[string]interface{}{"sub": "u1", "iss": "geex", "aud": "api"})
+		c.So(authRequest(engine, "/me", bearer(forged)).Code, c.ShouldEqual, http.StatusUnauthorized)
+		c.So(authRequest(engine, "/me", bearer("a.b")).Code, c.ShouldEqual, http.StatusUnauthorized)
+	})
+
+	c.Convey("test RS256 and ES256 from JWKS file", t, func() {
+		rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		c.So(err, c.ShouldBeNil)
+		ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		c.So(err, c.ShouldBeNil)
+		enc := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+		jwks, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{
+			{"kty": "RSA", "kid": "r1", "n": enc(rsaKey.N.Bytes()), "e": enc(big.NewInt(int64(rsaKey.E)).Bytes())},
+			{"kty": "EC", "kid": "e1", "crv": "P-256", "x": enc(ecKey.X.Bytes()), "y": enc(ecKey.Y.Bytes())},
+		}})
+		path := filepath.Join(t.TempDir(), "jwks.json")
+		c.So(ioutil.WriteFile(path, jwks, 0644), c.ShouldBeNil)
+
+		engine := newAuthEngine(JWTAuthWithConfig(JWTConfig{JWKSFile: path}))
+		claims := map[string]interface{}{"sub": "u2", "exp": exp}
+		w := authRequest(engine, "/me", map[string]string{"Authorization": "Bearer " + signJWT(JWTAlgRS256, "r1", rsaKey, claims)})
+		c.So(w.Body.String(), c.ShouldEqual, "bearer:u2")
+		w = authRequest(engine, "/me", map[string]string{"Authorization": "Bearer " + signJWT(JWTAlgES256, "e1", ecKey, claims)})
+		c.So(w.Body.String(), c.ShouldEqual, "bearer:u2")
+		// 算法与kid对应的密钥不匹配
+		w = authRequest(engine, "/me", map[string]string{"Authorization": "Bearer " + signJWT(JWTAlgES256, "r1", ecKey, claims)})
+		c.So(w.Code, c.ShouldEqual, http.StatusUnauthorized)
+		w = authRequest(engine, "/me", map[string]string{"Authorization": "Bearer " + signJWT("none", "", nil, claims)})
+		c.So(w.Code, c.ShouldEqual, http.StatusUnauthorized)
+	})
+
+	c.Convey("test key provider from container", t, func() {
+		engine := newAuthEngine(JWTAuthWithConfig(JWTConfig{}))
+		keys := staticKeys{"k1": []byte("from-container")}
+		c.So(engine.Bind(instanceProvider{name: contract.JWTKeyProviderKey, instance: keys}), c.ShouldBeNil)
+		token := signJWT(JWTAlgHS256, "k1", []byte("from-container"), map[string]interface{}{"sub": "u3"})
+		w := authRequest(engine, "/me", map[string]string{"Authorization": "Bearer " + token})
+		c.So(w.Body.String(), c.ShouldEqual, "bearer:u3")
+	})
+
+	c.Convey("test jwt key config errors", t, func() {
+		// 密钥文件在创建中间件时加载
+		c.So(func() {
+			JWTAuthWithConfig(JWTConfig{JWKSFile: filepath.Join(t.TempDir(), "missing.json")})
+		}, c.ShouldPanic)
+		// 没有任何密钥时返回500而不是每个请求都panic
+		engine := newAuthEngine(JWTAuthWithConfig(JWTConfig{}))
+		token := signJWT(JWTAlgHS256, "", []byte("secret"), map[string]interface{}{"sub": "u4"})
+		for i := 0; i < 2; i++ {
+			w := authRequest(engine, "/me", map[string]string{"Authorization": "Bearer " + token})
+			c.So(w.Code, c.ShouldEqual, http.StatusInternalServerError)
+		}
+	})
+}
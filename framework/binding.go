@@ -0,0 +1,266 @@
+package framework
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	gerrors "github.com/pkg/errors"
+	"github.com/spf13/cast"
+	"net/http"
+	"net/textproto"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	MIMEJSON              = "application/json"
+	MIMEXML               = "application/xml"
+	MIMEXML2              = "text/xml"
+	MIMEPOSTForm          = "application/x-www-form-urlencoded"
+	MIMEMultipartPOSTForm = "multipart/form-data"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// ContentType 请求的Content-Type，不包含charset等参数
+func (c *Context) ContentType() string {
+	ct, _ := c.Header("Content-Type")
+	if i := strings.IndexByte(ct, ';'); i >= 0 {
+		ct = ct[:i]
+	}
+	return strings.TrimSpace(strings.ToLower(ct))
+}
+
+// Bind 根据请求方法和Content-Type选择绑定方式，绑定后按validate标签校验
+// GET和HEAD请求绑定查询参数，其他请求按Content-Type绑定JSON、XML或表单
+func (c *Context) Bind(obj interface{}) error {
+	if c.Method == http.MethodGet || c.Method == http.MethodHead {
+		return c.BindQuery(obj)
+	}
+	switch c.ContentType() {
+	case MIMEJSON:
+		return c.BindJSON(obj)
+	case MIMEXML, MIMEXML2:
+		return c.BindXML(obj)
+	default:
+		return c.BindForm(obj)
+	}
+}
+
+// BindJSON 按json标签绑定请求体
+func (c *Context) BindJSON(obj interface{}) error {
+	if c.Req == nil || c.Req.Body == nil {
+		return gerrors.New("bind json: empty request body")
+	}
+	if err := json.NewDecoder(c.Req.Body).Decode(obj); err != nil {
+		return gerrors.Wrap(err, "bind json")
+	}
+	return validate(obj, "json")
+}
+
+// BindXML 按xml标签绑定请求体
+func (c *Context) BindXML(obj interface{}) error {
+	if c.Req == nil || c.Req.Body == nil {
+		return gerrors.New("bind xml: empty request body")
+	}
+	if err := xml.NewDecoder(c.Req.Body).Decode(obj); err != nil {
+		return gerrors.Wrap(err, "bind xml")
+	}
+	return validate(obj, "xml")
+}
+
+// BindQuery 按query标签绑定查询参数
+func (c *Context) BindQuery(obj interface{}) error {
+	values := c.QueryAll()
+	return c.bindValues(obj, "query", func(key string) ([]string, bool) {
+		v, ok := values[key]
+		return v, ok
+	})
+}
+
+// BindForm 按form标签绑定表单，同时支持urlencoded和multipart表单
+func (c *Context) BindForm(obj interface{}) error {
+	if err := c.parseForm(); err != nil {
+		return gerrors.Wrap(err, "bind form")
+	}
+	return c.bindValues(obj, "form", func(key string) ([]string, bool) {
+		v, ok := c.Req.Form[key]
+		return v, ok
+	})
+}
+
+// BindURI 按uri标签绑定动态路由参数
+func (c *Context) BindURI(obj interface{}) error {
+	return c.bindValues(obj, "uri", func(key string) ([]string, bool) {
+		v, ok := c.Params.Get(key)
+		return []string{v}, ok
+	})
+}
+
+// BindHeader 按header标签绑定请求头
+func (c *Context) BindHeader(obj interface{}) error {
+	return c.bindValues(obj, "header", func(key string) ([]string, bool) {
+		v, ok := c.Req.Header[textproto.CanonicalMIMEHeaderKey(key)]
+		return v, ok
+	})
+}
+
+func (c *Context) bindValues(obj interface{}, tag string, lookup func(string) ([]string, bool)) error {
+	rv := reflect.ValueOf(obj)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return gerrors.Errorf("bind %s: obj must be a non-nil pointer to struct, got %T", tag, obj)
+	}
+	if err := mapStruct(rv.Elem(), tag, lookup); err != nil {
+		return gerrors.Wrapf(err, "bind %s", tag)
+	}
+	return validate(obj, tag)
+}
+
+// mapStruct 按tag把key/value数据写入结构体，没有tag的字段使用字段名，tag为"-"的字段忽略
+func mapStruct(rv reflect.Value, tag string, lookup func(string) ([]string, bool)) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		if sf.PkgPath != "" && !sf.Anonymous {
+			continue
+		}
+		name := strings.Split(sf.Tag.Get(tag), ",")[0]
+		if name == "-" {
+			continue
+		}
+		fv := rv.Field(i)
+		// 没有tag的嵌套结构体递归绑定
+		if name == "" && isNestedStruct(sf.Type) {
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					fv.Set(reflect.New(sf.Type.Elem()))
+				}
+				fv = fv.Elem()
+			}
+			if err := mapStruct(fv, tag, lookup); err != nil {
+				return err
+			}
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		values, ok := lookup(name)
+		if !ok || len(values) == 0 {
+			continue
+		}
+		if err := setField(fv, sf, values); err != nil {
+			return gerrors.Wrapf(err, "field %s", name)
+		}
+	}
+	return nil
+}
+
+func isNestedStruct(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct && t != timeType
+}
+
+func setField(fv reflect.Value, sf reflect.StructField, values []string) error {
+	switch fv.Kind() {
+	case reflect.Ptr:
+		v := reflect.New(fv.Type().Elem())
+		if err := setField(v.Elem(), sf, values); err != nil {
+			return err
+		}
+		fv.Set(v)
+		return nil
+	case reflect.Slice:
+		slice := reflect.MakeSlice(fv.Type(), len(values), len(values))
+		for i, value := range values {
+			if err := setValue(slice.Index(i), sf, value); err != nil {
+				return err
+			}
+		}
+		fv.Set(slice)
+		return nil
+	default:
+		return setValue(fv, sf, values[0])
+	}
+}
+
+func setValue(v reflect.Value, sf reflect.StructField, value string) error {
+	if v.Type() == timeType {
+		return setTime(v, sf, value)
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		if value == "" {
+			value = "false"
+		}
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Type() == reflect.TypeOf(time.Duration(0)) {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return err
+			}
+			v.SetInt(int64(d))
+			return nil
+		}
+		if value == "" {
+			value = "0"
+		}
+		n, err := strconv.ParseInt(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if value == "" {
+			value = "0"
+		}
+		n, err := strconv.ParseUint(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		if value == "" {
+			value = "0"
+		}
+		f, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return gerrors.Errorf("unsupported type %v", v.Type())
+	}
+	return nil
+}
+
+// setTime 有time_format标签时按该格式解析，否则交给cast识别常见格式
+func setTime(v reflect.Value, sf reflect.StructField, value string) error {
+	if value == "" {
+		return nil
+	}
+	if layout := sf.Tag.Get("time_format"); layout != "" {
+		t, err := time.Parse(layout, value)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	}
+	t, err := cast.ToTimeE(value)
+	if err != nil {
+		return err
+	}
+	v.Set(reflect.ValueOf(t))
+	return nil
+}
@@ -0,0 +1,104 @@
+package framework
+
+import (
+	"encoding/json"
+	c "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type bindAddress struct {
+	City string `json:"city" form:"city" validate:"required"`
+}
+
+type bindUser struct {
+	Name    string      `json:"name" form:"name" query:"name" validate:"required,min=2,max=8"`
+	Email   string      `json:"email" form:"email" validate:"email"`
+	Role    string      `json:"role" form:"role" validate:"oneof=admin guest"`
+	Code    string      `json:"code" form:"code" validate:"regexp=^[a-z]{2,3}$"`
+	Tags    []string    `json:"tags" form:"tag" query:"tag" validate:"max=2"`
+	Age     *int        `json:"age" form:"age" validate:"min=18"`
+	Born    time.Time   `json:"born" form:"born" time_format:"2006-01-02"`
+	Address bindAddress `json:"address"`
+}
+
+type bindResource struct {
+	ID    int64  `uri:"id" validate:"required,min=1"`
+	Token string `header:"X-Token" validate:"required"`
+}
+
+func newBindContext(method, target, contentType, body string) *Context {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+	return newContext(httptest.NewRecorder(), r)
+}
+
+func TestBind(t *testing.T) {
+	c.Convey("test bind query, form, uri and header", t, func() {
+		ctx := newBindContext(http.MethodPost, "/?name=query", MIMEPOSTForm,
+			"name=geex&email=a@b.com&role=admin&tag=a&tag=b&age=20&born=2020-01-02&code=ab&city=sh")
+		ctx.Params = Params{{Key: "id", Value: "7"}}
+		ctx.Req.Header.Set("X-Token", "secret")
+		var user bindUser
+		c.So(ctx.Bind(&user), c.ShouldBeNil)
+		c.So(user.Name, c.ShouldEqual, "geex")
+		c.So(user.Tags, c.ShouldResemble, []string{"a", "b"})
+		c.So(*user.Age, c.ShouldEqual, 20)
+		c.So(user.Born.Format("2006-01-02"), c.ShouldEqual, "2020-01-02")
+		c.So(user.Address.City, c.ShouldEqual, "sh")
+
+		var res bindResource
+		c.So(ctx.BindURI(&res), c.ShouldNotBeNil)
+		c.So(res.ID, c.ShouldEqual, 7)
+		c.So(ctx.BindHeader(&res), c.ShouldBeNil)
+		c.So(res.Token, c.ShouldEqual, "secret")
+
+		var query bindUser
+		ctx = newBindContext(http.MethodGet, "/?name=geex&tag=x", "", "")
+		err := ctx.Bind(&query)
+		c.So(err, c.ShouldNotBeNil)
+		c.So(query.Name, c.ShouldEqual, "geex")
+		c.So(query.Tags, c.ShouldResemble, []string{"x"})
+
+		ctx = newBindContext(http.MethodPost, "/", MIMEPOSTForm, "age=abc")
+		c.So(ctx.BindForm(&query), c.ShouldNotBeNil)
+	})
+
+	c.Convey("test bind json with validation errors", t, func() {
+		ctx := newBindContext(http.MethodPost, "/", "application/json; charset=utf-8",
+			`{"name":"g","email":"bad","role":"root","code":"A1","tags":["a","b","c"],"age":3,"address":{}}`)
+		var user bindUser
+		err := ctx.Bind(&user)
+		ve, ok := err.(ValidationErrors)
+		c.So(ok, c.ShouldBeTrue)
+		rules := make(map[string]string)
+		for _, fe := range ve {
+			rules[fe.Field] = fe.Rule
+		}
+		c.So(rules, c.ShouldResemble, map[string]string{
+			"name":         "min",
+			"email":        "email",
+			"role":         "oneof",
+			"code":         "regexp",
+			"tags":         "max",
+			"age":          "min",
+			"address.city": "required",
+		})
+
+		w := httptest.NewRecorder()
+		ctx = newContext(w, ctx.Req)
+		ctx.Fail(http.StatusBadRequest, err)
+		c.So(w.Code, c.ShouldEqual, http.StatusBadRequest)
+		var resp struct {
+			Message string       `json:"message"`
+			Errors  []FieldError `json:"errors"`
+		}
+		c.So(json.Unmarshal(w.Body.Bytes(), &resp), c.ShouldBeNil)
+		c.So(resp.Errors, c.ShouldHaveLength, 7)
+	})
+}
@@ -0,0 +1,390 @@
+package framework
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"github.com/andybalholm/brotli"
+	"github.com/hiholder/geex/framework/contract"
+	gerrors "github.com/pkg/errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	EncodingBrotli  = "br"
+	EncodingGzip    = "gzip"
+	EncodingDeflate = "deflate"
+)
+
+const defaultCompressMinLength = 1024
+
+// 默认不压缩的Content-Type，以"/"结尾的按前缀匹配
+var defaultExcludedContentTypes = []string{
+	"image/", "video/", "audio/", "font/woff", "font/woff2",
+	"application/zip", "application/gzip", "application/x-gzip", "application/x-bzip2",
+	"application/x-7z-compressed", "application/x-rar-compressed", "application/x-xz", "application/zstd",
+}
+
+// CompressConfig 压缩中间件的配置，为零值的字段从配置服务的compress.*中获取
+type CompressConfig struct {
+	// 按优先级排列的编码，客户端的q值相同时优先使用靠前的，默认为br、gzip、deflate，对应compress.encodings
+	Encodings []string
+	// 压缩级别，为nil时使用gzip.DefaultCompression，对应compress.level
+	// gzip和deflate的取值为-2到9，br使用同样的值，小于0时使用brotli的默认级别
+	Level *int
+	// 响应体小于该字节数时不压缩，默认为1024，对应compress.min_length
+	MinLength int
+	// 不压缩的路径前缀，对应compress.excluded_paths
+	ExcludedPaths []string
+	// 额外不压缩的Content-Type，以"/"结尾的按前缀匹配，对应compress.excluded_content_types
+	ExcludedContentTypes []string
+}
+
+// encoder 三种压缩算法共同的方法，用于对象池复用
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// compressor 一种编码的encoder对象池
+type compressor struct {
+	pool sync.Pool
+}
+
+func newCompressor(encoding string, level int) *compressor {
+	// New会被并发调用，不能修改捕获的变量
+	brotliLevel := level
+	if brotliLevel < 0 {
+		brotliLevel = brotli.DefaultCompression
+	}
+	cp := &compressor{}
+	cp.pool.New = func() interface{} {
+		switch encoding {
+		case EncodingBrotli:
+			return brotli.NewWriterLevel(io.Discard, brotliLevel)
+		case EncodingDeflate:
+			w, err := flate.NewWriter(io.Discard, level)
+			if err != nil {
+				panic(err)
+			}
+			return w
+		default:
+			w, err := gzip.NewWriterLevel(io.Discard, level)
+			if err != nil {
+				panic(err)
+			}
+			return w
+		}
+	}
+	return cp
+}
+
+func (cp *compressor) get(w io.Writer) encoder {
+	enc := cp.pool.Get().(encoder)
+	enc.Reset(w)
+	return enc
+}
+
+func (cp *compressor) put(enc encoder) {
+	enc.Reset(io.Discard)
+	cp.pool.Put(enc)
+}
+
+// Compress 按配置服务中的compress配置压缩响应
+func Compress() HandlerFunc {
+	return CompressWithConfig(CompressConfig{})
+}
+
+// CompressWithConfig 根据Accept-Encoding压缩响应，支持br、gzip和deflate
+// 响应体先缓存到MinLength字节，再根据Content-Type和大小决定是否压缩
+// Flush时立即开始压缩并输出已有的数据，websocket升级等Hijack的请求不压缩
+func CompressWithConfig(conf CompressConfig) HandlerFunc {
+	// 直接传入的配置在创建中间件时检查，配置服务中的配置在第一个请求时检查
+	if _, err := loadCompressConfig(nil, conf); err != nil {
+		panic(err)
+	}
+	var (
+		once        sync.Once
+		compressors map[string]*compressor
+		loadErr     error
+	)
+	return func(c *Context) {
+		once.Do(func() {
+			loaded, err := loadCompressConfig(c.container, conf)
+			if err != nil {
+				loadErr = err
+				log.Printf("[geex] WARNING: %v", err)
+				return
+			}
+			conf = loaded
+			compressors = make(map[string]*compressor, len(conf.Encodings))
+			for _, encoding := range conf.Encodings {
+				compressors[encoding] = newCompressor(encoding, *conf.Level)
+			}
+		})
+		if loadErr != nil {
+			misconfigured(c, "compress")
+			return
+		}
+		for _, prefix := range conf.ExcludedPaths {
+			if strings.HasPrefix(c.Path, prefix) {
+				c.Next()
+				return
+			}
+		}
+		header := c.Writer.Header()
+		addVary(header, "Accept-Encoding")
+		// HEAD没有响应体，Range请求的部分内容不能整体压缩，Upgrade请求会接管连接
+		if c.Method == http.MethodHead || c.Req.Header.Get("Range") != "" || c.Req.Header.Get("Upgrade") != "" {
+			c.Next()
+			return
+		}
+		encoding := negotiateEncoding(c.Req.Header.Get("Accept-Encoding"), conf.Encodings)
+		if encoding == "" {
+			c.Next()
+			return
+		}
+		cw := &compressWriter{
+			ResponseWriter: c.Writer,
+			encoding:       encoding,
+			compressor:     compressors[encoding],
+			conf:           &conf,
+		}
+		c.Writer = cw
+		defer func() {
+			cw.close()
+			c.Writer = cw.ResponseWriter
+		}()
+		c.Next()
+	}
+}
+
+// loadCompressConfig 用配置服务补全conf中为零值的字段，编码或级别不支持时返回错误
+func loadCompressConfig(container Container, conf CompressConfig) (CompressConfig, error) {
+	if container != nil && container.IsBind(contract.ConfigKey) {
+		if config, ok := container.MustMake(contract.ConfigKey).(contract.Config); ok {
+			if conf.Encodings == nil && config.IsExist("compress.encodings") {
+				conf.Encodings = config.GetStringSlice("compress.encodings")
+			}
+			if conf.Level == nil && config.IsExist("compress.level") {
+				level := config.GetInt("compress.level")
+				conf.Level = &level
+			}
+			if conf.MinLength == 0 && config.IsExist("compress.min_length") {
+				conf.MinLength = config.GetInt("compress.min_length")
+			}
+			if conf.ExcludedPaths == nil && config.IsExist("compress.excluded_paths") {
+				conf.ExcludedPaths = config.GetStringSlice("compress.excluded_paths")
+			}
+			if conf.ExcludedContentTypes == nil && config.IsExist("compress.excluded_content_types") {
+				conf.ExcludedContentTypes = config.GetStringSlice("compress.excluded_content_types")
+			}
+		}
+	}
+	encodings := conf.Encodings
+	if len(encodings) == 0 {
+		encodings = []string{EncodingBrotli, EncodingGzip, EncodingDeflate}
+	}
+	// 复制一份再规范化，不修改调用方的切片
+	conf.Encodings = make([]string, len(encodings))
+	for i, encoding := range encodings {
+		conf.Encodings[i] = strings.ToLower(strings.TrimSpace(encoding))
+		switch conf.Encodings[i] {
+		case EncodingBrotli, EncodingGzip, EncodingDeflate:
+		default:
+			return conf, gerrors.Errorf("compress: unsupported encoding %q", encoding)
+		}
+	}
+	if conf.Level == nil {
+		level := gzip.DefaultCompression
+		conf.Level = &level
+	}
+	if *conf.Level < gzip.HuffmanOnly || *conf.Level > gzip.BestCompression {
+		return conf, gerrors.Errorf("compress: invalid level %d", *conf.Level)
+	}
+	if conf.MinLength == 0 {
+		conf.MinLength = defaultCompressMinLength
+	}
+	conf.ExcludedContentTypes = append(append([]string{}, defaultExcludedContentTypes...), conf.ExcludedContentTypes...)
+	return conf, nil
+}
+
+// negotiateEncoding 按Accept-Encoding中的q值选择编码，q值相同时按supported的顺序，都不接受时返回空
+func negotiateEncoding(accept string, supported []string) string {
+	if accept == "" {
+		return ""
+	}
+	weights := make(map[string]float64)
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		if name == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		weights[name] = q
+	}
+	best, bestQ := "", 0.0
+	for _, encoding := range supported {
+		q, ok := weights[encoding]
+		if !ok {
+			q = weights["*"]
+		}
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+func addVary(header http.Header, value string) {
+	for _, v := range header.Values("Vary") {
+		for _, field := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), value) || strings.TrimSpace(field) == "*" {
+				return
+			}
+		}
+	}
+	header.Add("Vary", value)
+}
+
+// compressWriter 缓存响应体的前MinLength字节，之后决定是否压缩
+type compressWriter struct {
+	ResponseWriter
+	encoding   string
+	compressor *compressor
+	conf       *CompressConfig
+	buf        []byte
+	decided    bool
+	enc        encoder
+}
+
+var _ ResponseWriter = &compressWriter{}
+
+// decide 决定是否压缩并写出缓存的数据，final表示响应已经结束，此时才检查最小长度
+func (w *compressWriter) decide(final bool) error {
+	if w.decided {
+		return nil
+	}
+	w.decided = true
+	header := w.Header()
+	if header.Get("Content-Type") == "" && len(w.buf) > 0 {
+		header.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+	if w.shouldCompress(final) {
+		header.Set("Content-Encoding", w.encoding)
+		header.Del("Content-Length")
+		w.enc = w.compressor.get(w.ResponseWriter)
+	}
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := w.write(buf)
+	return err
+}
+
+func (w *compressWriter) shouldCompress(final bool) bool {
+	header := w.Header()
+	if !bodyAllowedForStatus(w.Status()) || w.Status() == http.StatusPartialContent {
+		return false
+	}
+	if header.Get("Content-Encoding") != "" || header.Get("Content-Range") != "" {
+		return false
+	}
+	if final && len(w.buf) < w.conf.MinLength {
+		return false
+	}
+	contentType := strings.ToLower(header.Get("Content-Type"))
+	if i := strings.IndexByte(contentType, ';'); i >= 0 {
+		contentType = contentType[:i]
+	}
+	contentType = strings.TrimSpace(contentType)
+	if contentType == "image/svg+xml" {
+		return true
+	}
+	for _, excluded := range w.conf.ExcludedContentTypes {
+		if strings.HasSuffix(excluded, "/") && strings.HasPrefix(contentType, excluded) || contentType == excluded {
+			return false
+		}
+	}
+	return true
+}
+
+func (w *compressWriter) write(data []byte) (int, error) {
+	if w.enc != nil {
+		return w.enc.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	if w.decided {
+		return w.write(data)
+	}
+	w.buf = append(w.buf, data...)
+	if len(w.buf) >= w.conf.MinLength {
+		if err := w.decide(false); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Written 缓存中有数据时也视为已经写出，此时不能再改写响应
+func (w *compressWriter) Written() bool {
+	return len(w.buf) > 0 || w.ResponseWriter.Written()
+}
+
+func (w *compressWriter) WriteHeaderNow() {
+	w.decide(false)
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+// Flush 流式响应时立即输出，已经开始压缩时先刷新压缩的数据
+func (w *compressWriter) Flush() {
+	w.decide(false)
+	if w.enc != nil {
+		w.enc.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// Hijack 接管连接后不再压缩
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if w.enc != nil || len(w.buf) > 0 {
+		return nil, nil, gerrors.New("compress: hijack after response body written")
+	}
+	w.decided = true
+	return w.ResponseWriter.Hijack()
+}
+
+// close 处理链结束时写出剩余的数据，并把encoder放回对象池
+func (w *compressWriter) close() {
+	w.decide(true)
+	if w.enc != nil {
+		w.enc.Close()
+		w.compressor.put(w.enc)
+		w.enc = nil
+	}
+}
@@ -0,0 +1,249 @@
+package framework
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"github.com/andybalholm/brotli"
+	"github.com/hiholder/geex/framework/contract"
+	c "github.com/smartystreets/goconvey/convey"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func decompress(encoding string, body []byte) string {
+	var r io.Reader
+	switch encoding {
+	case EncodingGzip:
+		gr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return "invalid gzip: " + err.Error()
+		}
+		r = gr
+	case EncodingDeflate:
+		r = flate.NewReader(bytes.NewReader(body))
+	case EncodingBrotli:
+		r = brotli.NewReader(bytes.NewReader(body))
+	default:
+		r = bytes.NewReader(body)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "invalid body: " + err.Error()
+	}
+	return string(data)
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	c.Convey("test accept-encoding negotiation", t, func() {
+		supported := []string{EncodingBrotli, EncodingGzip, EncodingDeflate}
+		c.So(negotiateEncoding("", supported), c.ShouldBeEmpty)
+		c.So(negotiateEncoding("gzip, br", supported), c.ShouldEqual, EncodingBrotli)
+		c.So(negotiateEncoding("deflate, gzip;q=0.5", supported), c.ShouldEqual, EncodingDeflate)
+		c.So(negotiateEncoding("br;q=0, *", supported), c.ShouldEqual, EncodingGzip)
+		c.So(negotiateEncoding("identity", supported), c.ShouldBeEmpty)
+	})
+}
+
+func TestCompressLevel(t *testing.T) {
+	c.Convey("test compression level and encodings config", t, func() {
+		large := strings.Repeat("geex compress ", 200)
+		encodings := []string{" GZIP ", "BR"}
+		noCompression := gzip.NoCompression
+		engine := New()
+		engine.Use(CompressWithConfig(CompressConfig{Encodings: encodings, Level: &noCompression}))
+		engine.Get("/text", func(ctx *Context) {
+			ctx.String(http.StatusOK, large)
+		})
+
+		for _, encoding := range []string{EncodingGzip, EncodingBrotli} {
+			r := httptest.NewRequest(http.MethodGet, "/text", nil)
+			r.Header.Set("Accept-Encoding", encoding)
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, r)
+			c.So(w.Header().Get("Content-Encoding"), c.ShouldEqual, encoding)
+			c.So(decompress(encoding, w.Body.Bytes()), c.ShouldEqual, large)
+			// gzip不压缩时输出不会比原文小，brotli的0级仍会压缩
+			if encoding == EncodingGzip {
+				c.So(w.Body.Len(), c.ShouldBeGreaterThanOrEqualTo, len(large))
+			}
+		}
+		c.So(encodings, c.ShouldResemble, []string{" GZIP ", "BR"})
+	})
+}
+
+func TestCompressConcurrent(t *testing.T) {
+	c.Convey("test concurrent requests with the default brotli level", t, func() {
+		large := strings.Repeat("geex compress ", 200)
+		const n = 8
+		// 所有请求都到达后再写响应，使对象池同时创建多个encoder，用-race检查
+		var ready sync.WaitGroup
+		ready.Add(n)
+		engine := New()
+		engine.Use(Compress())
+		engine.Get("/text", func(ctx *Context) {
+			ready.Done()
+			ready.Wait()
+			ctx.String(http.StatusOK, large)
+		})
+		bodies := make(chan string, n)
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				r := httptest.NewRequest(http.MethodGet, "/text", nil)
+				r.Header.Set("Accept-Encoding", EncodingBrotli)
+				w := httptest.NewRecorder()
+				engine.ServeHTTP(w, r)
+				bodies <- decompress(w.Header().Get("Content-Encoding"), w.Body.Bytes())
+			}()
+		}
+		wg.Wait()
+		close(bodies)
+		for body := range bodies {
+			c.So(body, c.ShouldEqual, large)
+		}
+	})
+}
+
+func TestCompressConfigCheck(t *testing.T) {
+	c.Convey("test invalid compress config", t, func() {
+		c.So(func() { CompressWithConfig(CompressConfig{Encodings: []string{"zstd"}}) }, c.ShouldPanic)
+		level := 20
+		c.So(func() { CompressWithConfig(CompressConfig{Level: &level}) }, c.ShouldPanic)
+
+		// 配置服务中的配置无效时每个请求都返回500，而不是不压缩
+		engine := New()
+		c.So(engine.Bind(instanceProvider{name: contract.ConfigKey, instance: mapConfig{
+			"compress.encodings": []string{"gzip", "zstd"},
+		}}), c.ShouldBeNil)
+		engine.Use(Compress())
+		engine.Get("/text", func(ctx *Context) {
+			ctx.String(http.StatusOK, "text")
+		})
+		for i := 0; i < 2; i++ {
+			r := httptest.NewRequest(http.MethodGet, "/text", nil)
+			r.Header.Set("Accept-Encoding", EncodingGzip)
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, r)
+			c.So(w.Code, c.ShouldEqual, http.StatusInternalServerError)
+		}
+	})
+}
+
+func TestCompress(t *testing.T) {
+	c.Convey("test compress middleware", t, func() {
+		large := strings.Repeat("geex compress ", 200)
+		engine := New()
+		engine.Use(CompressWithConfig(CompressConfig{ExcludedPaths: []string{"/raw"}}))
+		engine.Get("/text", func(ctx *Context) {
+			ctx.String(http.StatusOK, large)
+		})
+		engine.Get("/small", func(ctx *Context) {
+			ctx.String(http.StatusOK, "small")
+		})
+		engine.Get("/png", func(ctx *Context) {
+			ctx.Data(http.StatusOK, []byte("\x89PNG\r\n\x1a\n"+large))
+		})
+		engine.Get("/raw", func(ctx *Context) {
+			ctx.String(http.StatusOK, large)
+		})
+		engine.Get("/stream", func(ctx *Context) {
+			ctx.SetHeader("Content-Type", "text/event-stream")
+			ctx.Writer.WriteString("data: 1\n\n")
+			ctx.Writer.Flush()
+			ctx.Writer.WriteString("data: 2\n\n")
+		})
+		engine.Get("/ws", func(ctx *Context) {
+			_, _, err := ctx.Writer.Hijack()
+			if err != nil {
+				panic(err)
+			}
+		})
+		request := func(path, accept string) *httptest.ResponseRecorder {
+			r := httptest.NewRequest(http.MethodGet, path, nil)
+			r.Header.Set("Accept-Encoding", accept)
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, r)
+			return w
+		}
+
+		for _, encoding := range []string{EncodingGzip, EncodingDeflate, EncodingBrotli} {
+			w := request("/text", encoding)
+			c.So(w.Header().Get("Content-Encoding"), c.ShouldEqual, encoding)
+			c.So(w.Header().Get("Vary"), c.ShouldEqual, "Accept-Encoding")
+			c.So(w.Body.Len(), c.ShouldBeLessThan, len(large))
+			c.So(decompress(encoding, w.Body.Bytes()), c.ShouldEqual, large)
+		}
+
+		w := request("/small", "gzip")
+		c.So(w.Header().Get("Content-Encoding"), c.ShouldBeEmpty)
+		c.So(w.Body.String(), c.ShouldEqual, "small")
+
+		w = request("/png", "gzip")
+		c.So(w.Header().Get("Content-Encoding"), c.ShouldBeEmpty)
+		c.So(w.Header().Get("Content-Type"), c.ShouldEqual, "image/png")
+
+		w = request("/raw", "gzip")
+		c.So(w.Header().Get("Content-Encoding"), c.ShouldBeEmpty)
+		c.So(w.Body.String(), c.ShouldEqual, large)
+
+		w = request("/text", "identity")
+		c.So(w.Header().Get("Content-Encoding"), c.ShouldBeEmpty)
+		c.So(w.Header().Get("Vary"), c.ShouldEqual, "Accept-Encoding")
+
+		// Flush时即使数据较少也开始压缩，保证流式响应及时输出
+		w = request("/stream", "gzip")
+		c.So(w.Flushed, c.ShouldBeTrue)
+		c.So(w.Header().Get("Content-Encoding"), c.ShouldEqual, EncodingGzip)
+		c.So(decompress(EncodingGzip, w.Body.Bytes()), c.ShouldEqual, "data: 1\n\ndata: 2\n\n")
+
+		rec := &hijackRecorder{ResponseRecorder: httptest.NewRecorder()}
+		r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		engine.ServeHTTP(rec, r)
+		c.So(rec.hijacked, c.ShouldBeTrue)
+	})
+
+	c.Convey("test compress static files", t, func() {
+		dir := t.TempDir()
+		content := strings.Repeat("body { color: red; }\n", 100)
+		c.So(ioutil.WriteFile(filepath.Join(dir, "site.css"), []byte(content), os.ModePerm), c.ShouldBeNil)
+		engine := New()
+		engine.Use(Compress())
+		engine.Static("/assets", dir)
+
+		r := httptest.NewRequest(http.MethodGet, "/assets/site.css", nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, r)
+		c.So(w.Code, c.ShouldEqual, http.StatusOK)
+		c.So(w.Header().Get("Content-Encoding"), c.ShouldEqual, EncodingGzip)
+		c.So(w.Header().Get("Content-Length"), c.ShouldBeEmpty)
+		c.So(decompress(EncodingGzip, w.Body.Bytes()), c.ShouldEqual, content)
+	})
+}
+
+func BenchmarkCompressGzip(b *testing.B) {
+	body := strings.Repeat("geex compress ", 200)
+	engine := New()
+	engine.Use(Compress())
+	engine.Get("/", func(ctx *Context) {
+		ctx.String(http.StatusOK, body)
+	})
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		engine.ServeHTTP(httptest.NewRecorder(), r)
+	}
+}
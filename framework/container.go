@@ -2,6 +2,7 @@ package framework
 
 import (
 	gerrors "github.com/pkg/errors"
+	"io"
 	"sync"
 )
 
@@ -108,3 +109,20 @@ func (gxc *GeeXContainer) newInstance(sp ServiceProvider, params []interface{})
 	}
 	return inst, nil
 }
+
+// Close 关闭所有已实例化且实现了io.Closer的服务，返回遇到的第一个错误
+func (gxc *GeeXContainer) Close() error {
+	gxc.mu.Lock()
+	defer gxc.mu.Unlock()
+	var first error
+	for key, instance := range gxc.instanceMap {
+		closer, ok := instance.(io.Closer)
+		if !ok {
+			continue
+		}
+		if err := closer.Close(); err != nil && first == nil {
+			first = gerrors.Wrapf(err, "close %s failed", key)
+		}
+	}
+	return first
+}
@@ -1,10 +1,12 @@
 package framework
 
 import (
-	"encoding/json"
-	"encoding/xml"
 	"fmt"
+	"github.com/hiholder/geex/framework/render"
+	gerrors "github.com/pkg/errors"
 	"github.com/spf13/cast"
+	"html/template"
+	"math"
 	"net/http"
 	"sync"
 	"time"
@@ -12,15 +14,22 @@ import (
 
 type H map[string]interface{}
 
+// abortIndex 处理链被中断后index的取值，大于任何合法的处理链长度
+const abortIndex int = math.MaxInt8 / 2
+
 // Context 请求上下文
+// Context由Engine复用，请求处理结束后不能在其他goroutine中继续使用
 type Context struct {
 	// origin objects
-	Writer http.ResponseWriter
+	writer responseWriter
+	Writer ResponseWriter
 	Req    *http.Request
 	// 请求信息
 	Path   string
 	Method string
-	Params map[string]string // 动态路由参数
+	Params Params // 动态路由参数
+	// 匹配到的路由
+	fullPath string
 	// 结果信息
 	StatusCode int
 	// middleware
@@ -34,27 +43,50 @@ type Context struct {
 	hasTimeout bool
 	// 服务容器
 	container  Container
+	// 请求结束后仍被其他goroutine引用，不能放回对象池
+	detached bool
+	// 请求范围内的键值存储
+	store *contextStore
+	// 请求范围的模板函数，覆盖LoadHTMLGlob中注册的同名函数
+	htmlFuncs template.FuncMap
 }
 
 func newContext(w http.ResponseWriter, r *http.Request) *Context {
-
-	return &Context{
-		Writer:    w,
-		Req:       r,
-		Path:      r.URL.Path,
-		Method:    r.Method,
-		index:     -1,
-		writerMux: &sync.Mutex{},
-	}
+	c := &Context{writerMux: &sync.Mutex{}, store: &contextStore{}}
+	c.Writer = &c.writer
+	c.reset(w, r)
+	return c
+}
+
+// reset 清空上一个请求的数据，Params保留已分配的空间
+func (c *Context) reset(w http.ResponseWriter, r *http.Request) {
+	c.writer.reset(w)
+	c.Writer = &c.writer
+	c.Req = r
+	c.Path = r.URL.Path
+	c.Method = r.Method
+	c.Params = c.Params[:0]
+	c.fullPath = ""
+	c.StatusCode = 0
+	c.handlers = nil
+	c.index = -1
+	c.hasTimeout = false
+	c.detached = false
+	c.htmlFuncs = nil
+	c.store.reset()
 }
 
 // 获取表单数据
 
+// FormAll 请求体中的表单数据，第一次访问时按Content-Type解析urlencoded或multipart表单
 func (c *Context) FormAll() map[string][]string {
-	if c.Req != nil {
-		return c.Req.PostForm
+	if c.Req == nil {
+		return map[string][]string{}
+	}
+	if err := c.parseForm(); err != nil || c.Req.PostForm == nil {
+		return map[string][]string{}
 	}
-	return map[string][]string{}
+	return c.Req.PostForm
 }
 
 func (c *Context) FormInt(key string, def int) (int, bool) {
@@ -103,6 +135,7 @@ func (c *Context) FormString(key string, def string) (string, bool) {
 }
 
 func (c *Context) PostForm(key string) string {
+	c.parseForm()
 	return c.Req.FormValue(key)
 }
 
@@ -192,109 +225,190 @@ func (c *Context) Cookie(key string) (string, bool) {
 	return "", false
 }
 
+// Status 设置状态码，状态码在写入响应体时才会真正写出，超时后不再生效
 func (c *Context) Status(code int) {
+	c.writerMux.Lock()
+	defer c.writerMux.Unlock()
+	if c.hasTimeout {
+		return
+	}
+	c.status(code)
+}
+
+// status 调用方需要持有writerMux
+func (c *Context) status(code int) {
 	c.StatusCode = code
 	c.Writer.WriteHeader(code)
 }
 
+// SetHeader 设置响应头，超时后不再生效
 func (c *Context) SetHeader(key string, value string) {
+	c.writerMux.Lock()
+	defer c.writerMux.Unlock()
+	if c.hasTimeout {
+		return
+	}
 	c.Writer.Header().Set(key, value)
 }
 
+// SetHasTimeout 标记请求已超时，之后所有的写入操作都不再生效
 func (c *Context) SetHasTimeout() {
+	c.writerMux.Lock()
+	defer c.writerMux.Unlock()
 	c.hasTimeout = true
 }
 
+// HasTimeout 请求是否已超时
+func (c *Context) HasTimeout() bool {
+	c.writerMux.Lock()
+	defer c.writerMux.Unlock()
+	return c.hasTimeout
+}
+
 // 构造相应
 // 构造String响应
 func (c *Context) String(code int, format string, values ...interface{}) {
-	c.SetHeader("Content-Type", "text/plain")
-	c.Status(code)
-	c.Writer.Write([]byte(fmt.Sprintf(format, values...)))
+	c.Render(code, render.Text{Format: format, Data: values})
 }
 
 // JSON 构造JSON响应
 func (c *Context) JSON(code int, obj interface{}) {
-	if c.hasTimeout {
-		return
-	}
-	defer c.writerMux.Unlock()
-	c.SetHeader("Content-Type", "application/json")
-	c.Status(code)
-	c.writerMux.Lock()
-	encoder := json.NewEncoder(c.Writer)
-	if err := encoder.Encode(obj); err != nil {
-		http.Error(c.Writer, err.Error(), 500)
-	}
+	c.Render(code, render.JSON{Data: obj})
+}
+
+// IndentedJSON 构造带缩进的JSON响应
+func (c *Context) IndentedJSON(code int, obj interface{}) {
+	c.Render(code, render.IndentedJSON{Data: obj})
+}
+
+// SecureJSON 构造JSON响应，数据为数组时加上"while(1);"前缀防止JSON劫持
+func (c *Context) SecureJSON(code int, obj interface{}) {
+	c.Render(code, render.SecureJSON{Data: obj})
+}
+
+// JSONP 构造JSONP响应，回调函数名取自查询参数callback
+func (c *Context) JSONP(code int, obj interface{}) {
+	c.Render(code, render.JSONP{Callback: c.Query("callback"), Data: obj})
+}
+
+// YAML 构造YAML响应
+func (c *Context) YAML(code int, obj interface{}) {
+	c.Render(code, render.YAML{Data: obj})
 }
 
 // Data 构造Data响应
 func (c *Context) Data(code int, data []byte) {
-	c.Status(code)
-	c.Writer.Write(data)
+	c.Render(code, render.Data{Data: data})
 }
 
 // HTML 构造HTML响应
 func (c *Context) HTML(code int, name string, data interface{}) {
-	if c.hasTimeout {
-		return
+	var tmpl *template.Template
+	if c.engine != nil {
+		tmpl = c.engine.htmlTemplates
+		// 模板函数在解析时绑定，请求范围的函数需要在模板副本上替换
+		// 副本在对象池中复用，渲染结束后恢复为LoadHTMLGlob中的函数再放回
+		if len(c.htmlFuncs) > 0 && c.engine.htmlClones != nil {
+			clones, funcMap := c.engine.htmlClones, c.engine.htmlFuncMap
+			clone := clones.Get().(*template.Template)
+			clone.Funcs(c.htmlFuncs)
+			defer func() {
+				reset := make(template.FuncMap, len(c.htmlFuncs))
+				for name := range c.htmlFuncs {
+					reset[name] = funcMap[name]
+				}
+				clones.Put(clone.Funcs(reset))
+			}()
+			tmpl = clone
+		}
 	}
-	c.SetHeader("Content-Type", "text/html")
-	// 拥有渲染模板的能力
-	if err := c.engine.htmlTemplates.ExecuteTemplate(c.Writer, name, data); err != nil {
-		c.Fail(http.StatusInternalServerError, err.Error())
+	c.Render(code, render.HTML{Template: tmpl, Name: name, Data: data})
+}
+
+// setHTMLFunc 设置请求范围的模板函数，name需要已经在LoadHTMLGlob中注册
+func (c *Context) setHTMLFunc(name string, fn interface{}) {
+	if c.htmlFuncs == nil {
+		c.htmlFuncs = make(template.FuncMap)
 	}
-	c.Status(code)
+	c.htmlFuncs[name] = fn
 }
 
 func (c *Context) Xml(code int, obj interface{}) {
-	marshal, err := xml.Marshal(obj)
-	if err != nil {
-		c.Fail(http.StatusInternalServerError, err.Error())
-	}
-	c.SetHeader("Content-Type", "application/html")
-	_, err = c.Writer.Write(marshal)
-	if err != nil {
-		c.Fail(http.StatusInternalServerError, err.Error())
-	}
-	c.Status(code)
+	c.Render(code, render.XML{Data: obj})
 }
 
 func (c *Context) Redirect(path string) {
+	c.writerMux.Lock()
+	defer c.writerMux.Unlock()
+	if c.hasTimeout {
+		return
+	}
+	c.StatusCode = http.StatusMovedPermanently
 	http.Redirect(c.Writer, c.Req, path, http.StatusMovedPermanently)
 }
 
+// FullPath 匹配到的路由，例如"/user/:id"，未匹配到路由时为空
+func (c *Context) FullPath() string {
+	return c.fullPath
+}
+
 // Param 可以访问到解析的参数，比如可以通过c.Param("lang")方法获取到对应的值
 func (c *Context) Param(key string) string {
-	value, _ := c.Params[key]
-	return value
+	return c.Params.ByName(key)
 }
 
+// Next 执行处理链中的下一个handler，中间件可以在Next前后插入自己的逻辑
 func (c *Context) Next() {
 	c.index++
-	s := len(c.handlers)
-	for ; c.index < s; c.index++ {
+	for c.index < len(c.handlers) {
 		c.handlers[c.index](c)
+		c.index++
 	}
 }
 
-// Fail 请求失败
-func (c *Context) Fail(code int, err string) {
-	c.index = len(c.handlers)
-	c.JSON(code, H{
-		"message": err,
-	})
+// Abort 中断处理链，当前handler返回后不会再执行后续的handler
+func (c *Context) Abort() {
+	c.index = abortIndex
+}
+
+// IsAborted 处理链是否已被中断
+func (c *Context) IsAborted() bool {
+	return c.index >= abortIndex
+}
+
+// AbortWithStatus 中断处理链并写入状态码
+func (c *Context) AbortWithStatus(code int) {
+	c.Status(code)
+	c.Abort()
+}
+
+// Fail 请求失败，err可以是字符串或error，参数校验错误会额外输出字段错误列表
+func (c *Context) Fail(code int, err interface{}) {
+	c.Abort()
+	var ve ValidationErrors
+	switch e := err.(type) {
+	case string:
+		c.JSON(code, H{"message": e})
+	case error:
+		if gerrors.As(e, &ve) {
+			c.JSON(code, H{"message": ve.Error(), "errors": ve})
+			return
+		}
+		c.JSON(code, H{"message": e.Error()})
+	default:
+		c.JSON(code, H{"message": fmt.Sprint(e)})
+	}
 }
 
 func (c *Context) Done() <-chan struct{} {
-	if c.Req == nil || c.Req.Context() == nil {
+	if c.Req == nil {
 		return nil
 	}
 	return c.Req.Context().Done()
 }
 
 func (c *Context) Deadline() (deadline time.Time, ok bool) {
-	if c.Req == nil || c.Req.Context() == nil {
+	if c.Req == nil {
 		return
 	}
 	return c.Req.Context().Deadline()
@@ -0,0 +1,11 @@
+package contract
+
+import "context"
+
+const JWTKeyProviderKey = "geex:jwt_keys"
+
+// JWTKeyProvider 提供验证JWT签名的密钥，例如从远程JWKS地址或密钥管理服务获取
+type JWTKeyProvider interface {
+	// Key 根据JWT头部的kid和alg返回密钥，HS256返回[]byte，RS256返回*rsa.PublicKey，ES256返回*ecdsa.PublicKey
+	Key(ctx context.Context, kid, alg string) (interface{}, error)
+}
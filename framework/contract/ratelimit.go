@@ -0,0 +1,31 @@
+package contract
+
+import (
+	"context"
+	"time"
+)
+
+const RateLimitKey = "geex:ratelimit"
+
+// 限流算法
+const (
+	// RateLimitTokenBucket 令牌桶，允许突发请求，令牌按limit/window的速率恢复
+	RateLimitTokenBucket = "token_bucket"
+	// RateLimitSlidingWindow 滑动窗口，按上一个窗口的计数加权估算最近window内的请求数
+	RateLimitSlidingWindow = "sliding_window"
+)
+
+// RateLimitResult 一次限流判断的结果
+type RateLimitResult struct {
+	Allowed    bool          // 是否允许本次请求
+	Limit      int           // window内允许的请求数
+	Remaining  int           // 本次请求之后剩余的请求数
+	Reset      time.Duration // 额度完全恢复还需要的时间
+	RetryAfter time.Duration // 被拒绝时多久之后可以重试
+}
+
+// RateLimitStore 限流数据的存储，多个实例共享限流数据时可以用redis等实现并绑定到容器中
+type RateLimitStore interface {
+	// Take 按algorithm消耗key的一次额度，limit为window内允许的请求数
+	Take(ctx context.Context, key string, algorithm string, limit int, window time.Duration) (RateLimitResult, error)
+}
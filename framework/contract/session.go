@@ -0,0 +1,19 @@
+package contract
+
+import (
+	"context"
+	"time"
+)
+
+const SessionKey = "geex:session"
+
+// SessionStore 服务端会话数据的存储，数据由框架编码，存储只负责按ID保存
+// 未绑定时会话数据加密后保存在cookie中
+type SessionStore interface {
+	// Load 读取会话数据，会话不存在或已经过期时返回nil, nil
+	Load(ctx context.Context, id string) ([]byte, error)
+	// Save 保存会话数据，ttl之后过期
+	Save(ctx context.Context, id string, data []byte, ttl time.Duration) error
+	// Delete 删除会话，会话不存在时不返回错误
+	Delete(ctx context.Context, id string) error
+}
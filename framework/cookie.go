@@ -0,0 +1,162 @@
+package framework
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	gerrors "github.com/pkg/errors"
+	"io"
+	"net/http"
+	"time"
+)
+
+// CookieOptions 写cookie时的属性
+type CookieOptions struct {
+	Path     string // 为空时为"/"
+	Domain   string
+	MaxAge   int // 秒，0表示会话cookie，小于0表示立即删除
+	Secure   bool
+	HttpOnly bool
+	SameSite http.SameSite // SameSite=None时浏览器要求同时设置Secure，会被自动加上
+}
+
+func newCookie(name, value string, opts CookieOptions) *http.Cookie {
+	if opts.Path == "" {
+		opts.Path = "/"
+	}
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     opts.Path,
+		Domain:   opts.Domain,
+		MaxAge:   opts.MaxAge,
+		Secure:   opts.Secure || opts.SameSite == http.SameSiteNoneMode,
+		HttpOnly: opts.HttpOnly,
+		SameSite: opts.SameSite,
+	}
+	if opts.MaxAge > 0 {
+		cookie.Expires = time.Now().Add(time.Duration(opts.MaxAge) * time.Second)
+	} else if opts.MaxAge < 0 {
+		cookie.Expires = time.Unix(1, 0)
+	}
+	return cookie
+}
+
+// SetCookie 在响应中添加Set-Cookie，超时后不再生效
+func (c *Context) SetCookie(name, value string, opts CookieOptions) {
+	c.writerMux.Lock()
+	defer c.writerMux.Unlock()
+	if c.hasTimeout {
+		return
+	}
+	http.SetCookie(c.Writer, newCookie(name, value, opts))
+}
+
+// DeleteCookie 让浏览器删除cookie，Path和Domain需要与写入时一致
+func (c *Context) DeleteCookie(name string, opts CookieOptions) {
+	opts.MaxAge = -1
+	c.SetCookie(name, "", opts)
+}
+
+var (
+	ErrCookieInvalid = gerrors.New("cookie is invalid")
+	ErrCookieExpired = gerrors.New("cookie is expired")
+)
+
+// cookieKey 由一个密钥派生出的签名密钥和加密密钥
+type cookieKey struct {
+	hash  []byte
+	block cipher.AEAD
+}
+
+// SecureCookie 对cookie的值加密并签名
+// 第一个密钥用于编码，所有密钥都可以用于解码，轮换密钥时把新密钥放在最前面
+type SecureCookie struct {
+	keys   []cookieKey
+	maxAge time.Duration
+}
+
+// NewSecureCookie 创建SecureCookie，maxAge大于0时解码会拒绝超过该时长的值
+func NewSecureCookie(maxAge time.Duration, keys ...[]byte) (*SecureCookie, error) {
+	if len(keys) == 0 {
+		return nil, gerrors.New("secure cookie: no key configured")
+	}
+	s := &SecureCookie{maxAge: maxAge}
+	for _, key := range keys {
+		if len(key) == 0 {
+			return nil, gerrors.New("secure cookie: empty key")
+		}
+		block, err := aes.NewCipher(deriveKey(key, "geex cookie encrypt"))
+		if err != nil {
+			return nil, gerrors.WithStack(err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, gerrors.WithStack(err)
+		}
+		s.keys = append(s.keys, cookieKey{hash: deriveKey(key, "geex cookie sign"), block: aead})
+	}
+	return s, nil
+}
+
+// deriveKey 从同一个密钥派生出用途不同的32字节密钥
+func deriveKey(key []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// Encode 用第一个密钥编码，结果为 base64(时间戳 | nonce | 密文 | 签名)，cookie名参与签名防止值被挪用
+func (s *SecureCookie) Encode(name string, value []byte) (string, error) {
+	key := s.keys[0]
+	nonce := make([]byte, key.block.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", gerrors.WithStack(err)
+	}
+	payload := make([]byte, 8, 8+len(nonce)+len(value)+key.block.Overhead()+sha256.Size)
+	binary.BigEndian.PutUint64(payload, uint64(time.Now().Unix()))
+	payload = append(payload, nonce...)
+	payload = key.block.Seal(payload, nonce, value, []byte(name))
+	payload = append(payload, cookieMAC(key.hash, name, payload)...)
+	return base64.RawURLEncoding.EncodeToString(payload), nil
+}
+
+// Decode 依次用所有密钥解码，rotated表示使用的不是第一个密钥，调用方应当重新编码
+func (s *SecureCookie) Decode(name, value string) (data []byte, rotated bool, err error) {
+	payload, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(payload) < 8+sha256.Size {
+		return nil, false, ErrCookieInvalid
+	}
+	body, sum := payload[:len(payload)-sha256.Size], payload[len(payload)-sha256.Size:]
+	for i, key := range s.keys {
+		if !hmac.Equal(cookieMAC(key.hash, name, body), sum) {
+			continue
+		}
+		issued := time.Unix(int64(binary.BigEndian.Uint64(body)), 0)
+		if s.maxAge > 0 && time.Since(issued) > s.maxAge {
+			return nil, false, ErrCookieExpired
+		}
+		nonceSize := key.block.NonceSize()
+		if len(body) < 8+nonceSize {
+			return nil, false, ErrCookieInvalid
+		}
+		data, err = key.block.Open(nil, body[8:8+nonceSize], body[8+nonceSize:], []byte(name))
+		if err != nil {
+			return nil, false, ErrCookieInvalid
+		}
+		return data, i > 0, nil
+	}
+	return nil, false, ErrCookieInvalid
+}
+
+func cookieMAC(key []byte, name string, payload []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(name))
+	mac.Write([]byte{0})
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,224 @@
+package framework
+
+import (
+	"github.com/hiholder/geex/framework/contract"
+	gerrors "github.com/pkg/errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var defaultCORSMethods = []string{
+	http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodHead, http.MethodOptions,
+}
+
+// CORSConfig 跨域配置，为零值的字段从配置服务的cors.*中获取
+type CORSConfig struct {
+	// 允许的来源，"*"表示全部，支持一个"*"通配符，例如"https://*.example.com"，对应cors.allow_origins
+	AllowOrigins []string
+	// 用正则表达式匹配允许的来源，对应cors.allow_origin_patterns
+	AllowOriginPatterns []string
+	// 自定义来源判断，与AllowOrigins和AllowOriginPatterns任意一个匹配即允许
+	AllowOriginFunc func(origin string) bool
+	// 允许的方法，默认为常用的方法，对应cors.allow_methods
+	AllowMethods []string
+	// 允许的请求头，为空时允许预检请求中声明的所有请求头，对应cors.allow_headers
+	AllowHeaders []string
+	// 允许前端读取的响应头，对应cors.expose_headers
+	ExposeHeaders []string
+	// 是否允许携带cookie，为true时不会返回"*"而是返回请求的来源，对应cors.allow_credentials
+	AllowCredentials bool
+	// 预检结果的缓存时间，对应cors.max_age，例如"12h"
+	MaxAge time.Duration
+}
+
+// corsPolicy 由CORSConfig预处理得到，请求时不再解析配置
+type corsPolicy struct {
+	allowAll      bool
+	origins       map[string]bool
+	wildcards     [][2]string
+	patterns      []*regexp.Regexp
+	originFunc    func(origin string) bool
+	methods       string
+	headers       string
+	exposeHeaders string
+	credentials   bool
+	maxAge        string
+}
+
+// CORS 使用配置服务中的cors配置处理跨域请求
+func CORS() HandlerFunc {
+	return CORSWithConfig(CORSConfig{})
+}
+
+// CORSWithConfig 处理跨域请求，预检请求直接返回204，不再执行后续的处理链
+// 使用Engine.Pre注册时预检请求在路由查找之前处理，不需要为每个路径注册OPTIONS路由
+func CORSWithConfig(conf CORSConfig) HandlerFunc {
+	// 直接传入的配置在创建中间件时检查，配置服务中的配置在第一个请求时检查
+	if _, err := newCORSPolicy(conf); err != nil {
+		panic(err)
+	}
+	var (
+		once    sync.Once
+		policy  *corsPolicy
+		loadErr error
+	)
+	return func(c *Context) {
+		once.Do(func() {
+			if policy, loadErr = newCORSPolicy(loadCORSConfig(c.container, conf)); loadErr != nil {
+				log.Printf("[geex] WARNING: %v", loadErr)
+			}
+		})
+		if loadErr != nil {
+			misconfigured(c, "cors")
+			return
+		}
+		origin := c.Req.Header.Get("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+		header := c.Writer.Header()
+		preflight := c.Method == http.MethodOptions && c.Req.Header.Get("Access-Control-Request-Method") != ""
+		if preflight {
+			header.Add("Vary", "Origin")
+			header.Add("Vary", "Access-Control-Request-Method")
+			header.Add("Vary", "Access-Control-Request-Headers")
+		} else {
+			header.Add("Vary", "Origin")
+		}
+		if !policy.allowOrigin(origin) {
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			c.Next()
+			return
+		}
+		if policy.allowAll && !policy.credentials {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+		}
+		if policy.credentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+		if !preflight {
+			if policy.exposeHeaders != "" {
+				header.Set("Access-Control-Expose-Headers", policy.exposeHeaders)
+			}
+			c.Next()
+			return
+		}
+		header.Set("Access-Control-Allow-Methods", policy.methods)
+		if policy.headers != "" {
+			header.Set("Access-Control-Allow-Headers", policy.headers)
+		} else if requested := c.Req.Header.Get("Access-Control-Request-Headers"); requested != "" {
+			header.Set("Access-Control-Allow-Headers", requested)
+		}
+		if policy.maxAge != "" {
+			header.Set("Access-Control-Max-Age", policy.maxAge)
+		}
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
+
+// loadCORSConfig 用配置服务补全conf中为零值的字段
+func loadCORSConfig(container Container, conf CORSConfig) CORSConfig {
+	if container == nil || !container.IsBind(contract.ConfigKey) {
+		return conf
+	}
+	config, ok := container.MustMake(contract.ConfigKey).(contract.Config)
+	if !ok {
+		return conf
+	}
+	stringSlice := func(value *[]string, key string) {
+		if *value == nil && config.IsExist(key) {
+			*value = config.GetStringSlice(key)
+		}
+	}
+	stringSlice(&conf.AllowOrigins, "cors.allow_origins")
+	stringSlice(&conf.AllowOriginPatterns, "cors.allow_origin_patterns")
+	stringSlice(&conf.AllowMethods, "cors.allow_methods")
+	stringSlice(&conf.AllowHeaders, "cors.allow_headers")
+	stringSlice(&conf.ExposeHeaders, "cors.expose_headers")
+	if !conf.AllowCredentials && config.IsExist("cors.allow_credentials") {
+		conf.AllowCredentials = config.GetBool("cors.allow_credentials")
+	}
+	if conf.MaxAge == 0 && config.IsExist("cors.max_age") {
+		d, err := time.ParseDuration(config.GetString("cors.max_age"))
+		if err != nil {
+			log.Printf("[geex] WARNING: invalid duration cors.max_age=%v: %v", config.Get("cors.max_age"), err)
+		}
+		conf.MaxAge = d
+	}
+	return conf
+}
+
+// newCORSPolicy 检查并预处理配置，正则不合法或允许任意来源时携带凭证返回错误
+func newCORSPolicy(conf CORSConfig) (*corsPolicy, error) {
+	policy := &corsPolicy{
+		origins:     make(map[string]bool),
+		originFunc:  conf.AllowOriginFunc,
+		credentials: conf.AllowCredentials,
+	}
+	for _, origin := range conf.AllowOrigins {
+		origin = strings.ToLower(strings.TrimSpace(origin))
+		switch i := strings.IndexByte(origin, '*'); {
+		case origin == "*":
+			policy.allowAll = true
+		case i >= 0:
+			policy.wildcards = append(policy.wildcards, [2]string{origin[:i], origin[i+1:]})
+		default:
+			policy.origins[origin] = true
+		}
+	}
+	// 允许任意来源时携带凭证等于允许任何网站读取用户的数据
+	if policy.allowAll && conf.AllowCredentials {
+		return nil, gerrors.New(`cors: AllowOrigins "*" cannot be used with AllowCredentials`)
+	}
+	// 正则需要匹配完整的Origin，否则https://a.example.com.evil.io也能匹配
+	for _, pattern := range conf.AllowOriginPatterns {
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, gerrors.Wrapf(err, "cors: invalid origin pattern %q", pattern)
+		}
+		policy.patterns = append(policy.patterns, re)
+	}
+	methods := conf.AllowMethods
+	if len(methods) == 0 {
+		methods = defaultCORSMethods
+	}
+	policy.methods = strings.ToUpper(strings.Join(methods, ", "))
+	policy.headers = strings.Join(conf.AllowHeaders, ", ")
+	policy.exposeHeaders = strings.Join(conf.ExposeHeaders, ", ")
+	if conf.MaxAge > 0 {
+		policy.maxAge = strconv.Itoa(int(conf.MaxAge / time.Second))
+	}
+	return policy, nil
+}
+
+func (p *corsPolicy) allowOrigin(origin string) bool {
+	if p.allowAll {
+		return true
+	}
+	lower := strings.ToLower(origin)
+	if p.origins[lower] {
+		return true
+	}
+	for _, w := range p.wildcards {
+		if len(lower) > len(w[0])+len(w[1]) && strings.HasPrefix(lower, w[0]) && strings.HasSuffix(lower, w[1]) {
+			return true
+		}
+	}
+	for _, re := range p.patterns {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+	return p.originFunc != nil && p.originFunc(origin)
+}
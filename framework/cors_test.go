@@ -0,0 +1,174 @@
+package framework
+
+import (
+	"github.com/hiholder/geex/framework/contract"
+	c "github.com/smartystreets/goconvey/convey"
+	"github.com/spf13/cast"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// mapConfig 以完整的key保存配置的contract.Config实现
+type mapConfig map[string]interface{}
+
+func (m mapConfig) IsExist(key string) bool            { _, ok := m[key]; return ok }
+func (m mapConfig) Get(key string) interface{}         { return m[key] }
+func (m mapConfig) GetBool(key string) bool            { return cast.ToBool(m[key]) }
+func (m mapConfig) GetInt(key string) int              { return cast.ToInt(m[key]) }
+func (m mapConfig) GetFloat64(key string) float64      { return cast.ToFloat64(m[key]) }
+func (m mapConfig) GetString(key string) string        { return cast.ToString(m[key]) }
+func (m mapConfig) GetTime(key string) time.Time       { return cast.ToTime(m[key]) }
+func (m mapConfig) GetIntSlice(key string) []int       { return cast.ToIntSlice(m[key]) }
+func (m mapConfig) GetStringSlice(key string) []string { return cast.ToStringSlice(m[key]) }
+func (m mapConfig) GetStringMap(key string) map[string]interface{} {
+	return cast.ToStringMap(m[key])
+}
+func (m mapConfig) GetStringMapString(key string) map[string]string {
+	return cast.ToStringMapString(m[key])
+}
+func (m mapConfig) GetStringMapStringSlice(key string) map[string][]string {
+	return cast.ToStringMapStringSlice(m[key])
+}
+func (m mapConfig) AddRemoteProvider(provider, endpoint, path string) error { return nil }
+func (m mapConfig) GetRemoteConfig() error                                  { return nil }
+func (m mapConfig) Load(key string, val interface{}) error                  { return nil }
+
+func corsRequest(engine *Engine, method, origin string, headers map[string]string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, "/api/user", nil)
+	if origin != "" {
+		r.Header.Set("Origin", origin)
+	}
+	for k, v := range headers {
+		r.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, r)
+	return w
+}
+
+func TestCORS(t *testing.T) {
+	c.Convey("test cors", t, func() {
+		engine := New()
+		engine.Pre(CORSWithConfig(CORSConfig{
+			AllowOrigins:        []string{"https://app.example.com", "https://*.geex.dev"},
+			AllowOriginPatterns: []string{`^http://localhost:\d+$`},
+			ExposeHeaders:       []string{"X-Request-ID"},
+			AllowCredentials:    true,
+			MaxAge:              time.Hour,
+		}))
+		engine.Get("/api/user", func(ctx *Context) {
+			ctx.String(http.StatusOK, "user")
+		})
+
+		// 没有OPTIONS路由时预检请求也直接返回
+		w := corsRequest(engine, http.MethodOptions, "https://app.example.com", map[string]string{
+			"Access-Control-Request-Method":  "PUT",
+			"Access-Control-Request-Headers": "X-Token",
+		})
+		c.So(w.Code, c.ShouldEqual, http.StatusNoContent)
+		c.So(w.Header().Get("Access-Control-Allow-Origin"), c.ShouldEqual, "https://app.example.com")
+		c.So(w.Header().Get("Access-Control-Allow-Credentials"), c.ShouldEqual, "true")
+		c.So(w.Header().Get("Access-Control-Allow-Methods"), c.ShouldContainSubstring, "PUT")
+		c.So(w.Header().Get("Access-Control-Allow-Headers"), c.ShouldEqual, "X-Token")
+		c.So(w.Header().Get("Access-Control-Max-Age"), c.ShouldEqual, "3600")
+		c.So(w.Header().Get("Allow"), c.ShouldBeEmpty)
+
+		w = corsRequest(engine, http.MethodGet, "https://api.geex.dev", nil)
+		c.So(w.Code, c.ShouldEqual, http.StatusOK)
+		c.So(w.Header().Get("Access-Control-Allow-Origin"), c.ShouldEqual, "https://api.geex.dev")
+		c.So(w.Header().Get("Access-Control-Expose-Headers"), c.ShouldEqual, "X-Request-ID")
+		c.So(w.Header().Values("Vary"), c.ShouldContain, "Origin")
+
+		w = corsRequest(engine, http.MethodGet, "http://localhost:3000", nil)
+		c.So(w.Header().Get("Access-Control-Allow-Origin"), c.ShouldEqual, "http://localhost:3000")
+
+		// 不允许的来源不返回跨域响应头，预检请求返回403
+		w = corsRequest(engine, http.MethodGet, "https://evil.com", nil)
+		c.So(w.Code, c.ShouldEqual, http.StatusOK)
+		c.So(w.Header().Get("Access-Control-Allow-Origin"), c.ShouldBeEmpty)
+		w = corsRequest(engine, http.MethodOptions, "https://geex.dev.evil.com", map[string]string{
+			"Access-Control-Request-Method": "GET",
+		})
+		c.So(w.Code, c.ShouldEqual, http.StatusForbidden)
+
+		// 非跨域请求不受影响
+		w = corsRequest(engine, http.MethodOptions, "", nil)
+		c.So(w.Code, c.ShouldEqual, http.StatusMethodNotAllowed)
+	})
+
+	c.Convey("test cors from config", t, func() {
+		engine := New()
+		c.So(engine.Bind(instanceProvider{name: contract.ConfigKey, instance: mapConfig{
+			"cors.allow_origins": []string{"*"},
+			"cors.allow_methods": []string{"get", "post"},
+			"cors.allow_headers": []string{"Content-Type"},
+			"cors.max_age":       "10m",
+		}}), c.ShouldBeNil)
+		engine.Use(CORS())
+		engine.Get("/api/user", func(ctx *Context) {
+			ctx.String(http.StatusOK, "user")
+		})
+
+		w := corsRequest(engine, http.MethodOptions, "https://any.com", map[string]string{
+			"Access-Control-Request-Method": "POST",
+		})
+		c.So(w.Code, c.ShouldEqual, http.StatusNoContent)
+		c.So(w.Header().Get("Access-Control-Allow-Origin"), c.ShouldEqual, "*")
+		c.So(w.Header().Get("Access-Control-Allow-Methods"), c.ShouldEqual, "GET, POST")
+		c.So(w.Header().Get("Access-Control-Allow-Headers"), c.ShouldEqual, "Content-Type")
+		c.So(w.Header().Get("Access-Control-Max-Age"), c.ShouldEqual, "600")
+	})
+}
+
+func TestCORSConfigCheck(t *testing.T) {
+	c.Convey("test cors origin patterns are anchored", t, func() {
+		engine := New()
+		engine.Pre(CORSWithConfig(CORSConfig{AllowOriginPatterns: []string{`https://.*\.example\.com`}}))
+		preflight := map[string]string{"Access-Control-Request-Method": "GET"}
+		c.So(corsRequest(engine, http.MethodOptions, "https://a.example.com", preflight).Code, c.ShouldEqual, http.StatusNoContent)
+		c.So(corsRequest(engine, http.MethodOptions, "https://a.example.com.evil.io", preflight).Code, c.ShouldEqual, http.StatusForbidden)
+		c.So(corsRequest(engine, http.MethodOptions, "evil://https://a.example.com", preflight).Code, c.ShouldEqual, http.StatusForbidden)
+	})
+
+	c.Convey("test wildcard origin with credentials panics", t, func() {
+		c.So(func() {
+			CORSWithConfig(CORSConfig{AllowOrigins: []string{"*"}, AllowCredentials: true})
+		}, c.ShouldPanic)
+		c.So(func() {
+			CORSWithConfig(CORSConfig{AllowOriginPatterns: []string{`https://(`}})
+		}, c.ShouldPanic)
+	})
+
+	c.Convey("test invalid cors config from config service", t, func() {
+		engine := New()
+		c.So(engine.Bind(instanceProvider{name: contract.ConfigKey, instance: mapConfig{
+			"cors.allow_origin_patterns": []string{`https://(`},
+		}}), c.ShouldBeNil)
+		engine.Pre(CORS())
+		engine.Get("/api/user", func(ctx *Context) {
+			ctx.String(http.StatusOK, "user")
+		})
+		// 每个请求都返回500，不会在第一个请求之后使用未初始化的配置
+		for i := 0; i < 2; i++ {
+			w := corsRequest(engine, http.MethodGet, "https://app.example.com", nil)
+			c.So(w.Code, c.ShouldEqual, http.StatusInternalServerError)
+			c.So(w.Body.String(), c.ShouldContainSubstring, "cors misconfigured")
+		}
+	})
+}
+
+func TestCORSOriginFunc(t *testing.T) {
+	c.Convey("test cors origin func", t, func() {
+		re := regexp.MustCompile(`\.internal$`)
+		engine := New()
+		engine.Pre(CORSWithConfig(CORSConfig{AllowOriginFunc: re.MatchString}))
+		w := corsRequest(engine, http.MethodOptions, "http://svc.internal", map[string]string{
+			"Access-Control-Request-Method": "GET",
+		})
+		c.So(w.Code, c.ShouldEqual, http.StatusNoContent)
+		c.So(w.Header().Get("Access-Control-Allow-Origin"), c.ShouldEqual, "http://svc.internal")
+	})
+}
@@ -0,0 +1,274 @@
+package framework
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"github.com/hiholder/geex/framework/contract"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// csrfTokenLength 未掩码的token字节数
+const csrfTokenLength = 32
+
+// csrfSessionKey 绑定会话时token在会话中的键
+const csrfSessionKey = "_csrf_token"
+
+type csrfKey struct{}
+
+// CSRFConfig CSRF中间件的配置，为零值的字段从配置服务的csrf.*中读取
+type CSRFConfig struct {
+	// token保存在会话中，需要在之前使用Sessions中间件
+	// 为false时如果请求已经有会话同样保存在会话中，没有会话时使用double submit cookie
+	UseSession bool
+	// double submit cookie的签名密钥，对应csrf.key，为空时启动时随机生成，重启后旧的cookie失效
+	// 签名使其他子域名无法写入自己构造的token
+	Key        []byte
+	CookieName string        // double submit cookie的名字，默认为"_csrf"
+	Cookie     CookieOptions // SameSite默认为Lax，前端需要读取cookie时不能设置HttpOnly
+	FieldName  string        // 表单字段名，默认为"_csrf"
+	HeaderName string        // 请求头，默认为"X-CSRF-Token"
+	// 不检查的路径前缀，例如使用token认证的API分组"/api/"
+	ExcludePaths []string
+	// 返回true时不检查
+	Skipper func(*Context) bool
+	// 除本站外允许发起请求的来源，例如"https://admin.example.com"
+	TrustedOrigins []string
+}
+
+// CSRF 使用double submit cookie的CSRF中间件
+func CSRF() HandlerFunc {
+	return CSRFWithConfig(CSRFConfig{})
+}
+
+// CSRFWithConfig 为每个请求准备token，并检查不安全方法的Origin/Referer和提交的token
+// 模板中用{{ csrfField }}输出隐藏的表单字段，用{{ csrfToken }}输出token
+func CSRFWithConfig(conf CSRFConfig) HandlerFunc {
+	var once sync.Once
+	return func(c *Context) {
+		once.Do(func() {
+			conf = loadCSRFConfig(c.container, conf)
+			if len(conf.Key) == 0 {
+				log.Printf("[geex] WARNING: csrf.key not configured, csrf cookies are signed with a random key")
+				conf.Key = newCSRFToken()
+			}
+		})
+		if conf.Skipper != nil && conf.Skipper(c) {
+			c.Next()
+			return
+		}
+		for _, prefix := range conf.ExcludePaths {
+			if strings.HasPrefix(c.Path, prefix) {
+				c.Next()
+				return
+			}
+		}
+
+		token := conf.loadToken(c)
+		c.Req = c.Req.WithContext(context.WithValue(c.Req.Context(), csrfKey{}, token))
+		fieldName := conf.FieldName
+		c.setHTMLFunc("csrfToken", func() string {
+			return maskCSRFToken(token)
+		})
+		c.setHTMLFunc("csrfField", func() template.HTML {
+			return template.HTML(`<input type="hidden" name="` + template.HTMLEscapeString(fieldName) +
+				`" value="` + maskCSRFToken(token) + `">`)
+		})
+
+		if !safeMethod(c.Method) {
+			if reason := conf.checkOrigin(c); reason != "" {
+				csrfFailed(c, reason)
+				return
+			}
+			submitted := c.Req.Header.Get(conf.HeaderName)
+			if submitted == "" {
+				submitted = c.PostForm(conf.FieldName)
+			}
+			if !validCSRFToken(token, submitted) {
+				csrfFailed(c, "csrf token invalid")
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// loadToken 读取已有的token，没有时生成新的token并保存
+// 有会话时token与会话绑定，否则保存在签名的cookie中
+func (conf *CSRFConfig) loadToken(c *Context) []byte {
+	if session := c.Session(); session != nil {
+		if token, err := base64.RawURLEncoding.DecodeString(session.GetString(csrfSessionKey)); err == nil && len(token) == csrfTokenLength {
+			return token
+		}
+		token := newCSRFToken()
+		session.Set(csrfSessionKey, base64.RawURLEncoding.EncodeToString(token))
+		return token
+	}
+	if conf.UseSession {
+		panic("csrf: UseSession requires the Sessions middleware")
+	}
+	if value, ok := c.Cookie(conf.CookieName); ok {
+		if signed, err := base64.RawURLEncoding.DecodeString(value); err == nil && len(signed) == csrfTokenLength+sha256.Size {
+			token := signed[:csrfTokenLength]
+			if hmac.Equal(signed[csrfTokenLength:], conf.signToken(token)) {
+				return token
+			}
+		}
+	}
+	token := newCSRFToken()
+	signed := append(token[:csrfTokenLength:csrfTokenLength], conf.signToken(token)...)
+	c.SetCookie(conf.CookieName, base64.RawURLEncoding.EncodeToString(signed), conf.Cookie)
+	return token
+}
+
+// signToken cookie中token的HMAC-SHA256签名
+func (conf *CSRFConfig) signToken(token []byte) []byte {
+	mac := hmac.New(sha256.New, conf.Key)
+	mac.Write(token)
+	return mac.Sum(nil)
+}
+
+// checkOrigin 不安全的请求必须来自本站或可信来源，协议和主机都要相同
+// 有Origin时检查Origin，否则检查Referer，HTTPS请求不允许两者都没有
+func (conf *CSRFConfig) checkOrigin(c *Context) string {
+	origin := c.Req.Header.Get("Origin")
+	if origin == "" {
+		referer := c.Req.Header.Get("Referer")
+		if referer == "" {
+			if c.Scheme() == "https" {
+				return "referer missing"
+			}
+			return ""
+		}
+		origin = referer
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return "origin invalid"
+	}
+	if strings.EqualFold(u.Scheme, c.Scheme()) && strings.EqualFold(u.Host, c.Host()) {
+		return ""
+	}
+	for _, trusted := range conf.TrustedOrigins {
+		if t, err := url.Parse(trusted); err == nil && strings.EqualFold(t.Scheme, u.Scheme) && strings.EqualFold(t.Host, u.Host) {
+			return ""
+		}
+	}
+	return "origin not allowed"
+}
+
+func csrfFailed(c *Context, reason string) {
+	c.Abort()
+	errorResponse(c, http.StatusForbidden, "403 FORBIDDEN: "+reason)
+}
+
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+func newCSRFToken() []byte {
+	token := make([]byte, csrfTokenLength)
+	if _, err := io.ReadFull(rand.Reader, token); err != nil {
+		panic(err)
+	}
+	return token
+}
+
+// maskCSRFToken 每次输出时用随机数异或token，页面中的token每次都不同，防止BREACH攻击
+func maskCSRFToken(token []byte) string {
+	masked := make([]byte, 2*len(token))
+	if _, err := io.ReadFull(rand.Reader, masked[:len(token)]); err != nil {
+		panic(err)
+	}
+	for i, b := range token {
+		masked[len(token)+i] = b ^ masked[i]
+	}
+	return base64.RawURLEncoding.EncodeToString(masked)
+}
+
+func validCSRFToken(token []byte, submitted string) bool {
+	masked, err := base64.RawURLEncoding.DecodeString(submitted)
+	if err != nil || len(masked) != 2*csrfTokenLength {
+		return false
+	}
+	unmasked := make([]byte, csrfTokenLength)
+	for i := range unmasked {
+		unmasked[i] = masked[i] ^ masked[csrfTokenLength+i]
+	}
+	return subtle.ConstantTimeCompare(unmasked, token) == 1
+}
+
+// CSRFToken 当前请求可以提交的token，没有使用CSRF中间件时为空
+func (c *Context) CSRFToken() string {
+	if c.Req == nil {
+		return ""
+	}
+	token, ok := c.Req.Context().Value(csrfKey{}).([]byte)
+	if !ok {
+		return ""
+	}
+	return maskCSRFToken(token)
+}
+
+// noCSRFField 没有使用CSRF中间件时模板中的csrfField输出为空
+func noCSRFField() template.HTML {
+	return ""
+}
+
+func noCSRFToken() string {
+	return ""
+}
+
+func loadCSRFConfig(container Container, conf CSRFConfig) CSRFConfig {
+	if container != nil && container.IsBind(contract.ConfigKey) {
+		if config, ok := container.MustMake(contract.ConfigKey).(contract.Config); ok {
+			if !conf.UseSession {
+				conf.UseSession = config.GetBool("csrf.use_session")
+			}
+			if len(conf.Key) == 0 && config.IsExist("csrf.key") {
+				conf.Key = []byte(config.GetString("csrf.key"))
+			}
+			if conf.CookieName == "" {
+				conf.CookieName = config.GetString("csrf.cookie_name")
+			}
+			if conf.FieldName == "" {
+				conf.FieldName = config.GetString("csrf.field_name")
+			}
+			if conf.HeaderName == "" {
+				conf.HeaderName = config.GetString("csrf.header_name")
+			}
+			if conf.ExcludePaths == nil && config.IsExist("csrf.exclude_paths") {
+				conf.ExcludePaths = config.GetStringSlice("csrf.exclude_paths")
+			}
+			if conf.TrustedOrigins == nil && config.IsExist("csrf.trusted_origins") {
+				conf.TrustedOrigins = config.GetStringSlice("csrf.trusted_origins")
+			}
+		}
+	}
+	if conf.CookieName == "" {
+		conf.CookieName = "_csrf"
+	}
+	if conf.FieldName == "" {
+		conf.FieldName = "_csrf"
+	}
+	if conf.HeaderName == "" {
+		conf.HeaderName = "X-CSRF-Token"
+	}
+	if conf.Cookie.SameSite == 0 {
+		conf.Cookie.SameSite = http.SameSiteLaxMode
+	}
+	return conf
+}
@@ -0,0 +1,141 @@
+package framework
+
+import (
+	"encoding/base64"
+	c "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var csrfInput = regexp.MustCompile(`name="_csrf" value="([^"]+)"`)
+
+func newCSRFEngine(t *testing.T, handlers ...HandlerFunc) *Engine {
+	engine := New()
+	engine.Use(handlers...)
+	dir := t.TempDir()
+	c.So(os.WriteFile(filepath.Join(dir, "form.tmpl"), []byte(`<form>{{ csrfField }}</form>`), 0644), c.ShouldBeNil)
+	engine.LoadHTMLGlob(filepath.Join(dir, "*.tmpl"))
+	engine.Get("/form", func(ctx *Context) {
+		ctx.HTML(http.StatusOK, "form.tmpl", nil)
+	})
+	engine.Post("/form", func(ctx *Context) {
+		ctx.String(http.StatusOK, "saved")
+	})
+	engine.Post("/api/hook", func(ctx *Context) {
+		ctx.String(http.StatusOK, "hook")
+	})
+	return engine
+}
+
+func csrfPost(engine *Engine, path string, form url.Values, header map[string]string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", MIMEPOSTForm)
+	for k, v := range header {
+		r.Header.Set(k, v)
+	}
+	for _, cookie := range cookies {
+		r.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, r)
+	return w
+}
+
+func TestCSRF(t *testing.T) {
+	c.Convey("test double submit cookie", t, func() {
+		engine := newCSRFEngine(t, CSRFWithConfig(CSRFConfig{
+			ExcludePaths:   []string{"/api/"},
+			TrustedOrigins: []string{"https://admin.example.com"},
+		}))
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/form", nil))
+		cookies := w.Result().Cookies()
+		c.So(cookies, c.ShouldHaveLength, 1)
+		c.So(cookies[0].Name, c.ShouldEqual, "_csrf")
+		match := csrfInput.FindStringSubmatch(w.Body.String())
+		c.So(match, c.ShouldHaveLength, 2)
+		token := match[1]
+
+		c.So(csrfPost(engine, "/form", url.Values{"_csrf": {token}}, nil, cookies).Code, c.ShouldEqual, http.StatusOK)
+		c.So(csrfPost(engine, "/form", nil, map[string]string{"X-CSRF-Token": token}, cookies).Code, c.ShouldEqual, http.StatusOK)
+		c.So(csrfPost(engine, "/form", url.Values{"_csrf": {token}}, nil, nil).Code, c.ShouldEqual, http.StatusForbidden)
+		c.So(csrfPost(engine, "/form", nil, nil, cookies).Code, c.ShouldEqual, http.StatusForbidden)
+		c.So(csrfPost(engine, "/api/hook", nil, nil, nil).Code, c.ShouldEqual, http.StatusOK)
+
+		form := url.Values{"_csrf": {token}}
+		c.So(csrfPost(engine, "/form", form, map[string]string{"Origin": "https://evil.com"}, cookies).Code, c.ShouldEqual, http.StatusForbidden)
+		c.So(csrfPost(engine, "/form", form, map[string]string{"Referer": "http://example.com/form"}, cookies).Code, c.ShouldEqual, http.StatusOK)
+		c.So(csrfPost(engine, "/form", form, map[string]string{"Origin": "https://admin.example.com"}, cookies).Code, c.ShouldEqual, http.StatusOK)
+		c.So(csrfPost(engine, "/form", form, map[string]string{"Origin": "http://admin.example.com"}, cookies).Code, c.ShouldEqual, http.StatusForbidden)
+		// 主机相同但协议不同的来源不是本站
+		c.So(csrfPost(engine, "/form", form, map[string]string{"Origin": "https://example.com"}, cookies).Code, c.ShouldEqual, http.StatusForbidden)
+
+		// 其他子域名写入的未签名cookie不被接受
+		forged := make([]byte, csrfTokenLength)
+		planted := []*http.Cookie{{Name: "_csrf", Value: base64.RawURLEncoding.EncodeToString(forged)}}
+		c.So(csrfPost(engine, "/form", url.Values{"_csrf": {maskCSRFToken(forged)}}, nil, planted).Code, c.ShouldEqual, http.StatusForbidden)
+		// 用其他密钥签名的cookie同样无效
+		other := CSRFConfig{Key: []byte("other")}
+		planted[0].Value = base64.RawURLEncoding.EncodeToString(append(forged, other.signToken(forged)...))
+		c.So(csrfPost(engine, "/form", url.Values{"_csrf": {maskCSRFToken(forged)}}, nil, planted).Code, c.ShouldEqual, http.StatusForbidden)
+
+		// 没有使用中间件时模板同样可以渲染
+		plain := newCSRFEngine(t)
+		w = httptest.NewRecorder()
+		plain.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/form", nil))
+		c.So(w.Body.String(), c.ShouldEqual, "<form></form>")
+	})
+
+	c.Convey("test session bound token", t, func() {
+		engine := newCSRFEngine(t, Sessions([]byte("key")), CSRFWithConfig(CSRFConfig{UseSession: true}))
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/form", nil))
+		cookies := w.Result().Cookies()
+		c.So(cookies, c.ShouldHaveLength, 1)
+		c.So(cookies[0].Name, c.ShouldEqual, "geex_session")
+		token := csrfInput.FindStringSubmatch(w.Body.String())[1]
+
+		c.So(csrfPost(engine, "/form", url.Values{"_csrf": {token}}, nil, cookies).Code, c.ShouldEqual, http.StatusOK)
+		c.So(csrfPost(engine, "/form", url.Values{"_csrf": {token}}, nil, nil).Code, c.ShouldEqual, http.StatusForbidden)
+
+		// 有会话时默认与会话绑定，不再设置csrf cookie
+		engine = newCSRFEngine(t, Sessions([]byte("key")), CSRF())
+		w = httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/form", nil))
+		cookies = w.Result().Cookies()
+		c.So(cookies, c.ShouldHaveLength, 1)
+		c.So(cookies[0].Name, c.ShouldEqual, "geex_session")
+		token = csrfInput.FindStringSubmatch(w.Body.String())[1]
+		c.So(csrfPost(engine, "/form", url.Values{"_csrf": {token}}, nil, cookies).Code, c.ShouldEqual, http.StatusOK)
+	})
+
+	c.Convey("test reused template clones", t, func() {
+		engine := New()
+		dir := t.TempDir()
+		c.So(os.WriteFile(filepath.Join(dir, "page.tmpl"), []byte(`<script nonce="{{ cspNonce }}"></script><form>{{ csrfField }}</form>`), 0644), c.ShouldBeNil)
+		engine.LoadHTMLGlob(filepath.Join(dir, "*.tmpl"))
+		page := func(ctx *Context) {
+			ctx.HTML(http.StatusOK, "page.tmpl", nil)
+		}
+		engine.Get("/csrf/page", CSRF(), page)
+		engine.Get("/csp/page", SecureWithConfig(SecureConfig{
+			ContentSecurityPolicy: NewCSP().Add("script-src", CSPNonce).String(),
+		}), page)
+		for i := 0; i < 3; i++ {
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/csrf/page", nil))
+			c.So(w.Body.String(), c.ShouldStartWith, `<script nonce=""></script><form><input`)
+			// 放回对象池的副本不能带着上一个请求的token
+			w = httptest.NewRecorder()
+			engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/csp/page", nil))
+			c.So(w.Body.String(), c.ShouldEndWith, `"></script><form></form>`)
+			c.So(w.Body.String(), c.ShouldNotStartWith, `<script nonce=""`)
+		}
+	})
+}
@@ -1,10 +1,14 @@
 package framework
 
 import (
+	"context"
 	"fmt"
 	"html/template"
+	"log"
+	"net"
 	"net/http"
 	"strings"
+	"sync"
 )
 
 type HandlerFunc func(*Context)
@@ -15,16 +19,58 @@ type Engine struct {
 	methodTree map[string]*Tree // 为每个方法构建一棵路由树
 	// 模板渲染
 	htmlTemplates *template.Template // 模板
+	htmlClones    *sync.Pool         // 用于替换请求范围模板函数的模板副本，复用避免每次渲染都复制
+	htmlFuncMap   template.FuncMap   // 解析模板时使用的全部函数，副本放回时恢复
 	funcMap       template.FuncMap   // 自定义模板渲染函数
 	container     Container
+	// 路由未命中时的处理链
+	noRoute  []HandlerFunc
+	noMethod []HandlerFunc
+	// 加上全局中间件后的完整处理链，在中间件变化时重新计算
+	noRouteChain  []HandlerFunc
+	noMethodChain []HandlerFunc
+	// 在路由查找之前执行的中间件，最后一个handler为路由查找
+	preChain []HandlerFunc
+	// 复用Context，减少每个请求的内存分配
+	pool sync.Pool
+	// 所有路由树中参数个数的最大值，用于预分配Context的参数切片
+	maxParams int
+	// 命名路由，用于反向生成URL
+	namedRoutes map[string]*Route
+	// 按注册顺序保存所有注册成功的路由
+	routes []*Route
+	// debug模式下启动时打印路由表
+	debug bool
+	// 开发模式下panic时返回带源码的错误页面
+	devMode bool
+	// strict模式下路由注册失败直接panic
+	strict bool
+	// 解析multipart表单时保存在内存中的最大字节数，超出部分写入临时文件
+	maxMultipartMemory int64
+	// 单个上传文件的最大字节数，0表示不限制
+	maxUploadFileSize int64
+	// 可信代理，只有连接来自其中时才读取X-Forwarded-For等请求头
+	trustedProxies []*net.IPNet
+	// 服务生命周期
+	server        *http.Server
+	serverMu      sync.Mutex
+	shutdownHooks []func(ctx context.Context) error
+	shutdownOnce  sync.Once
+	shutdownErr   error
 }
 
 func New() *Engine {
 	engine := &Engine{}
 	engine.RouterGroup = newGroup(engine, "")
 	engine.methodTree = make(map[string]*Tree, 0)
+	engine.namedRoutes = make(map[string]*Route)
 	engine.groups = []*RouterGroup{engine.RouterGroup}
 	engine.container = NewGeeXContainer()
+	engine.maxMultipartMemory = defaultMultipartMemory
+	engine.pool.New = func() interface{} {
+		return engine.allocateContext()
+	}
+	engine.rebuildChains()
 	return engine
 }
 
@@ -34,65 +80,144 @@ func Default() *Engine {
 	return engine
 }
 
-func (e *Engine) addRouter(method, pattern string, handler HandlerFunc) {
+func (e *Engine) addRouter(method, pattern string, handlers []HandlerFunc) error {
 	if _, ok := e.methodTree[method]; !ok {
 		e.methodTree[method] = NewTree()
 	}
-	if err := e.methodTree[method].AddRouter(pattern, handler); err != nil {
-		fmt.Println(err)
+	tree := e.methodTree[method]
+	if err := tree.AddRouter(pattern, e.combineHandlers(pattern, handlers)); err != nil {
+		return fmt.Errorf("%v %v: %w", method, pattern, err)
+	}
+	if tree.MaxParams() > e.maxParams {
+		e.maxParams = tree.MaxParams()
+	}
+	return nil
+}
+
+// combineHandlers 在路由自身的处理链前加上作用于该路由的分组中间件
+func (e *Engine) combineHandlers(pattern string, handlers []HandlerFunc) []HandlerFunc {
+	middlewares := e.groupMiddlewares(pattern)
+	chain := make([]HandlerFunc, 0, len(middlewares)+len(handlers))
+	chain = append(chain, middlewares...)
+	return append(chain, handlers...)
+}
+
+// rebuildChains 中间件变化后重新计算所有路由和未命中路由时的处理链
+// 处理链在注册时确定，请求时不再需要查找分组中间件
+func (e *Engine) rebuildChains() {
+	for _, route := range e.routes {
+		e.methodTree[route.method].setHandlers(route.pattern, e.combineHandlers(route.pattern, route.handlers))
+	}
+	e.noRouteChain = e.errorChain(e.noRoute, notFound)
+	e.noMethodChain = e.errorChain(e.noMethod, methodNotAllowed)
+}
+
+// errorChain 未命中路由时只经过全局中间件，再执行自定义或默认的处理函数
+func (e *Engine) errorChain(handlers []HandlerFunc, def HandlerFunc) []HandlerFunc {
+	if len(handlers) == 0 {
+		handlers = []HandlerFunc{def}
+	}
+	chain := make([]HandlerFunc, 0, len(e.middleware)+len(handlers))
+	chain = append(chain, e.middleware...)
+	return append(chain, handlers...)
+}
+
+// SetDebug 开启debug模式，启动时打印路由表
+func (e *Engine) SetDebug(debug bool) {
+	e.debug = debug
+}
+
+// SetDevMode 开启开发模式，panic时默认的Recovery向客户端返回带源码的错误页面
+// 会暴露源码，只能在本地开发时开启
+func (e *Engine) SetDevMode(dev bool) {
+	e.devMode = dev
+}
+
+// SetStrict 开启strict模式，路由注册失败时直接panic
+func (e *Engine) SetStrict(strict bool) {
+	e.strict = strict
+}
+
+// routeError 处理路由注册的错误，strict模式下panic，否则打印警告
+func (e *Engine) routeError(err error) {
+	if e.strict {
+		panic(err)
 	}
+	log.Printf("[geex] WARNING: route register failed: %v", err)
 }
 
-func (r *RouterGroup) Get(pattern string, handler HandlerFunc) IGroup {
-	return r.addRouter(http.MethodGet, pattern, handler)
+func (r *RouterGroup) Get(pattern string, handlers ...HandlerFunc) IRoute {
+	return r.addRouter(http.MethodGet, pattern, handlers...)
 }
 
-func (r *RouterGroup) Post(pattern string, handler HandlerFunc) IGroup {
-	return r.addRouter(http.MethodPost, pattern, handler)
+func (r *RouterGroup) Post(pattern string, handlers ...HandlerFunc) IRoute {
+	return r.addRouter(http.MethodPost, pattern, handlers...)
 }
 
-func (r *RouterGroup) Delete(pattern string, handler HandlerFunc) IGroup {
-	return r.addRouter(http.MethodDelete, pattern, handler)
+func (r *RouterGroup) Delete(pattern string, handlers ...HandlerFunc) IRoute {
+	return r.addRouter(http.MethodDelete, pattern, handlers...)
 }
 
-func (r *RouterGroup) Patch(pattern string, handler HandlerFunc) IGroup {
-	return r.addRouter(http.MethodPatch, pattern, handler)
+func (r *RouterGroup) Patch(pattern string, handlers ...HandlerFunc) IRoute {
+	return r.addRouter(http.MethodPatch, pattern, handlers...)
 }
-func (r *RouterGroup) Put(pattern string, handler HandlerFunc) IGroup {
-	return r.addRouter(http.MethodPut, pattern, handler)
+func (r *RouterGroup) Put(pattern string, handlers ...HandlerFunc) IRoute {
+	return r.addRouter(http.MethodPut, pattern, handlers...)
 }
 
-func (r *RouterGroup) Options(pattern string, handler HandlerFunc) IGroup {
-	return r.addRouter(http.MethodOptions, pattern, handler)
+func (r *RouterGroup) Options(pattern string, handlers ...HandlerFunc) IRoute {
+	return r.addRouter(http.MethodOptions, pattern, handlers...)
 }
 
-func (r *RouterGroup) Head(pattern string, handler HandlerFunc) IGroup {
-	return r.addRouter(http.MethodHead, pattern, handler)
+func (r *RouterGroup) Head(pattern string, handlers ...HandlerFunc) IRoute {
+	return r.addRouter(http.MethodHead, pattern, handlers...)
 }
 
+// Run 在addr上启动HTTP服务，超时等配置从配置服务中读取，需要优雅退出时使用RunServer
 func (e *Engine) Run(addr string) error {
-	return http.ListenAndServe(addr, e)
+	options := e.loadServerOptions(&ServerOptions{Addr: addr})
+	options.CertFile, options.KeyFile = "", ""
+	return e.listenAndServe(options)
 }
 
-func (e *Engine) newContext(w http.ResponseWriter, r *http.Request) *Context {
-	c := newContext(w, r)
-	c.container = e.container
+func (e *Engine) allocateContext() *Context {
+	c := &Context{
+		Params:    make(Params, 0, e.maxParams),
+		engine:    e,
+		container: e.container,
+		writerMux: &sync.Mutex{},
+		store:     &contextStore{},
+	}
+	c.Writer = &c.writer
 	return c
 }
 
-func (e *Engine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+// groupMiddlewares 返回作用于该路由的所有分组中间件，按分组创建的顺序排列
+func (e *Engine) groupMiddlewares(path string) []HandlerFunc {
 	var middlewares []HandlerFunc
 	for _, group := range e.groups {
 		// 判断请求符合哪些中间件
-		if strings.HasPrefix(r.URL.Path, group.prefix) {
+		if strings.HasPrefix(path, group.prefix) {
 			middlewares = append(middlewares, group.middleware...)
 		}
 	}
-	fmt.Println(r.URL)
-	c := e.newContext(w, r)
-	c.handlers = middlewares
-	c.engine = e
+	return middlewares
+}
+
+func (e *Engine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c := e.pool.Get().(*Context)
+	c.reset(w, r)
 	e.handleServeHTTP(c)
+	// 只设置了状态码而没有响应体时，在这里写出响应头
+	c.Writer.WriteHeaderNow()
+	// 中间件用WithContext替换了请求时，net/http只会清理原始请求的multipart临时文件
+	if c.Req != r && c.Req.MultipartForm != nil && c.Req.MultipartForm != r.MultipartForm {
+		c.Req.MultipartForm.RemoveAll()
+	}
+	// 仍被超时的goroutine引用的Context不能复用
+	if !c.detached {
+		e.pool.Put(c)
+	}
 }
 
 // Bind 绑定服务容器
@@ -104,38 +229,149 @@ func (e *Engine) IsBind(key string) bool {
 	return e.container.IsBind(key)
 }
 
+// Pre 添加在路由查找之前执行的中间件，中断处理链时不再查找路由
+// 用于CORS预检、重定向等与路由无关的处理，即使路径没有对应的路由也会执行
+func (e *Engine) Pre(middlewares ...HandlerFunc) {
+	pre := e.preChain
+	if len(pre) > 0 {
+		pre = pre[:len(pre)-1]
+	}
+	chain := make([]HandlerFunc, 0, len(pre)+len(middlewares)+1)
+	chain = append(chain, pre...)
+	chain = append(chain, middlewares...)
+	e.preChain = append(chain, e.route)
+}
+
 func (e *Engine) handleServeHTTP(ctx *Context) {
-	handler, params := e.methodTree[ctx.Method].SearchRouter(ctx.Path)
-	if handler != nil {
-		ctx.Params = params
-		handler(ctx)
-	} else {
-		fmt.Println("not match router")
+	if len(e.preChain) > 0 {
+		ctx.handlers = e.preChain
+		ctx.Next()
+		return
+	}
+	e.route(ctx)
+}
+
+// route 查找路由，用匹配到的处理链替换当前的处理链并从头执行
+func (e *Engine) route(ctx *Context) {
+	ctx.index = -1
+	if tree, ok := e.methodTree[ctx.Method]; ok {
+		// 处理链已经包含分组中间件，统一由Next驱动
+		if handlers, pattern := tree.Find(ctx.Path, &ctx.Params); handlers != nil {
+			ctx.handlers = handlers
+			ctx.fullPath = pattern
+			ctx.Next()
+			return
+		}
+	}
+	// 路径能被其他方法匹配时返回405，否则返回404
+	if allow := e.allowedMethods(ctx.Method, ctx.Path); len(allow) > 0 {
+		ctx.SetHeader("Allow", strings.Join(allow, ", "))
+		ctx.handlers = e.noMethodChain
+		ctx.Next()
+		return
+	}
+	ctx.handlers = e.noRouteChain
+	ctx.Next()
+}
+
+// NoRoute 设置路由未匹配时的处理链，默认返回404
+func (e *Engine) NoRoute(handlers ...HandlerFunc) {
+	e.noRoute = handlers
+	e.noRouteChain = e.errorChain(handlers, notFound)
+}
+
+// NoMethod 设置路径存在但方法不匹配时的处理链，默认返回405
+func (e *Engine) NoMethod(handlers ...HandlerFunc) {
+	e.noMethod = handlers
+	e.noMethodChain = e.errorChain(handlers, methodNotAllowed)
+}
+
+// allowedMethods 探测其他方法的路由树，返回能够匹配该路径的方法
+func (e *Engine) allowedMethods(method, path string) []string {
+	var allow []string
+	for _, m := range anyMethods {
+		if m == method {
+			continue
+		}
+		tree, ok := e.methodTree[m]
+		if !ok {
+			continue
+		}
+		if handlers, _ := tree.Find(path, nil); handlers != nil {
+			allow = append(allow, m)
+		}
+	}
+	return allow
+}
+
+func notFound(c *Context) {
+	errorResponse(c, http.StatusNotFound, fmt.Sprintf("404 NOT FOUND: %s", c.Path))
+}
+
+func methodNotAllowed(c *Context) {
+	errorResponse(c, http.StatusMethodNotAllowed, fmt.Sprintf("405 METHOD NOT ALLOWED: %s %s", c.Method, c.Path))
+}
+
+// errorResponse 客户端接受JSON时返回JSON，否则返回纯文本
+func errorResponse(c *Context, code int, msg string) {
+	if accept, _ := c.Header("Accept"); strings.Contains(accept, "application/json") {
+		c.Fail(code, msg)
+		return
 	}
+	c.String(code, "%s\n", msg)
+}
+
+// misconfigured 中间件的配置在第一个请求时才能读取，配置无效时拒绝所有请求，错误只在第一次记录日志
+func misconfigured(c *Context, middleware string) {
+	c.Abort()
+	errorResponse(c, http.StatusInternalServerError, "500 INTERNAL SERVER ERROR: "+middleware+" misconfigured")
 }
 
-// Group 创建一个新分组并注册入Engine
+// Group 创建一个新分组并注册入Engine，子分组继承父分组的前缀
 func (r *RouterGroup) Group(prefix string) IGroup {
-	nGroup := newGroup(r.engine, prefix)
+	nGroup := newGroup(r.engine, r.prefix+prefix)
 	r.engine.groups = append(r.engine.groups, nGroup)
 	return nGroup
 }
 
-// 为分组添加路由
-func (r *RouterGroup) addRouter(method, comp string, handler HandlerFunc) IGroup {
+// 为分组添加路由，handlers按顺序组成该路由的处理链，最后一个为业务处理函数
+func (r *RouterGroup) addRouter(method, comp string, handlers ...HandlerFunc) IRoute {
 	pattern := r.prefix + comp
-	r.engine.addRouter(method, pattern, handler)
-	return r
+	route := &Route{RouterGroup: r, method: method, pattern: pattern, handlers: handlers}
+	if err := r.engine.addRouter(method, pattern, handlers); err != nil {
+		route.err = err
+		r.engine.routeError(err)
+		return route
+	}
+	r.engine.routes = append(r.engine.routes, route)
+	return route
 }
 
 func (r *RouterGroup) Use(middlewares ...HandlerFunc) {
 	r.middleware = append(r.middleware, middlewares...)
+	r.engine.rebuildChains()
 }
 
 func (e *Engine) SetFuncMap(funcMap template.FuncMap) {
 	e.funcMap = funcMap
 }
 
+// LoadHTMLGlob 加载模板，除自定义函数外模板中还可以使用框架内置的函数，例如url、csrfField、cspNonce
 func (e *Engine) LoadHTMLGlob(pattern string) {
-	e.htmlTemplates = template.Must(template.New("").Funcs(e.funcMap).ParseGlob(pattern))
+	funcMap := template.FuncMap{
+		"url":       e.urlFunc,
+		"csrfField": noCSRFField,
+		"csrfToken": noCSRFToken,
+		"cspNonce":  noCSPNonce,
+	}
+	for name, fn := range e.funcMap {
+		funcMap[name] = fn
+	}
+	e.htmlTemplates = template.Must(template.New("").Funcs(funcMap).ParseGlob(pattern))
+	// 执行过的模板不能再复制，提前保留一份没有执行过的作为副本的来源
+	base := template.Must(e.htmlTemplates.Clone())
+	e.htmlFuncMap = funcMap
+	e.htmlClones = &sync.Pool{New: func() interface{} {
+		return template.Must(base.Clone())
+	}}
 }
@@ -1,8 +1,11 @@
 package framework
 
 import (
+	c "github.com/smartystreets/goconvey/convey"
 	"log"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 )
@@ -67,3 +70,163 @@ func TestSimpleGee(t *testing.T) {
 	}
 	e.Run(":9999")
 }
+
+func TestHandlerChain(t *testing.T) {
+	c.Convey("test group and route middleware chain", t, func() {
+		engine := New()
+		var trace []string
+		mark := func(name string) HandlerFunc {
+			return func(ctx *Context) {
+				trace = append(trace, name+">")
+				ctx.Next()
+				trace = append(trace, "<"+name)
+			}
+		}
+		engine.Use(mark("global"))
+		v1 := engine.Group("/v1")
+		v1.Use(mark("group"))
+		v1.Get("/hello", mark("route"), func(ctx *Context) {
+			trace = append(trace, "handler")
+			ctx.String(http.StatusOK, "hello")
+		})
+		v1.Get("/abort", func(ctx *Context) {
+			ctx.Fail(http.StatusForbidden, "forbidden")
+		}, func(ctx *Context) {
+			trace = append(trace, "unreachable")
+		})
+
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/hello", nil))
+		c.So(w.Code, c.ShouldEqual, http.StatusOK)
+		c.So(strings.Join(trace, ","), c.ShouldEqual, "global>,group>,route>,handler,<route,<group,<global")
+
+		trace = nil
+		w = httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/abort", nil))
+		c.So(w.Code, c.ShouldEqual, http.StatusForbidden)
+		c.So(strings.Join(trace, ","), c.ShouldEqual, "global>,group>,<group,<global")
+	})
+}
+
+func TestNestedGroup(t *testing.T) {
+	c.Convey("test nested group inherits parent prefix and middleware", t, func() {
+		engine := New()
+		v1 := engine.Group("/v1")
+		v1.Use(func(ctx *Context) {
+			ctx.SetHeader("X-Group", "v1")
+			ctx.Next()
+		})
+		v1.Group("/admin").Get("/users", func(ctx *Context) {
+			ctx.String(http.StatusOK, ctx.Path)
+		})
+
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/admin/users", nil))
+		c.So(w.Code, c.ShouldEqual, http.StatusOK)
+		c.So(w.Body.String(), c.ShouldEqual, "/v1/admin/users")
+		c.So(w.Header().Get("X-Group"), c.ShouldEqual, "v1")
+
+		w = httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/users", nil))
+		c.So(w.Body.String(), c.ShouldNotEqual, "/admin/users")
+	})
+}
+
+func TestNoRoute(t *testing.T) {
+	c.Convey("test 404 and 405 handling", t, func() {
+		engine := New()
+		logged := 0
+		engine.Use(func(ctx *Context) {
+			logged++
+			ctx.Next()
+		})
+		engine.Get("/user/:id", func(ctx *Context) {
+			ctx.String(http.StatusOK, ctx.Param("id"))
+		})
+		engine.Put("/user/:id", func(ctx *Context) {
+			ctx.String(http.StatusOK, ctx.Param("id"))
+		})
+
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/missing", nil))
+		c.So(w.Code, c.ShouldEqual, http.StatusNotFound)
+		c.So(w.Body.String(), c.ShouldContainSubstring, "/missing")
+
+		w = httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/user/1", nil)
+		r.Header.Set("Accept", "application/json")
+		engine.ServeHTTP(w, r)
+		c.So(w.Code, c.ShouldEqual, http.StatusMethodNotAllowed)
+		c.So(w.Header().Get("Allow"), c.ShouldEqual, "GET, PUT")
+		c.So(w.Header().Get("Content-Type"), c.ShouldStartWith, "application/json")
+		c.So(logged, c.ShouldEqual, 2)
+
+		engine.NoRoute(func(ctx *Context) {
+			ctx.String(http.StatusNotFound, "custom")
+		})
+		w = httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/missing", nil))
+		c.So(w.Code, c.ShouldEqual, http.StatusNotFound)
+		c.So(w.Body.String(), c.ShouldEqual, "custom")
+	})
+}
+
+func TestContextReuse(t *testing.T) {
+	c.Convey("test pooled context and middleware added after routes", t, func() {
+		engine := New()
+		engine.Get("/user/:id", func(ctx *Context) {
+			ctx.String(http.StatusOK, "%s %d", ctx.Param("id"), len(ctx.Params))
+		})
+		engine.Get("/static", func(ctx *Context) {
+			ctx.String(http.StatusOK, "%d", len(ctx.Params))
+		})
+		// 路由注册之后添加的中间件同样生效
+		engine.Use(func(ctx *Context) {
+			ctx.SetHeader("X-Late", "1")
+			ctx.Next()
+		})
+
+		for _, tt := range []struct{ path, body string }{
+			{"/user/1", "1 1"},
+			{"/static", "0"},
+			{"/user/2", "2 1"},
+		} {
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			c.So(w.Body.String(), c.ShouldEqual, tt.body)
+			c.So(w.Header().Get("X-Late"), c.ShouldEqual, "1")
+		}
+	})
+}
+
+// benchWriter 可以复用的ResponseWriter，避免测试本身的内存分配
+type benchWriter struct {
+	header http.Header
+}
+
+func (w *benchWriter) Header() http.Header         { return w.header }
+func (w *benchWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *benchWriter) WriteHeader(int)             {}
+
+func benchmarkServeHTTP(b *testing.B, pattern, path string) {
+	engine := New()
+	engine.Use(func(ctx *Context) { ctx.Next() })
+	engine.Group("/api").Get(pattern, func(ctx *Context) {
+		ctx.Status(http.StatusOK)
+	})
+	w := &benchWriter{header: make(http.Header)}
+	r := httptest.NewRequest(http.MethodGet, "/api"+path, nil)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		engine.ServeHTTP(w, r)
+	}
+}
+
+func BenchmarkServeHTTPStatic(b *testing.B) {
+	benchmarkServeHTTP(b, "/user/list", "/user/list")
+}
+
+func BenchmarkServeHTTPParam(b *testing.B) {
+	benchmarkServeHTTP(b, "/user/:id/post/:pid", "/user/42/post/7")
+}
@@ -0,0 +1,381 @@
+package framework
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/hiholder/geex/framework/contract"
+	gerrors "github.com/pkg/errors"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 支持的JWT签名算法
+const (
+	JWTAlgHS256 = "HS256"
+	JWTAlgRS256 = "RS256"
+	JWTAlgES256 = "ES256"
+)
+
+var (
+	ErrTokenMalformed = gerrors.New("token is malformed")
+	ErrTokenSignature = gerrors.New("token signature is invalid")
+	ErrTokenExpired   = gerrors.New("token is expired")
+	ErrTokenNotValid  = gerrors.New("token is not valid yet")
+	ErrTokenIssuer    = gerrors.New("token issuer is invalid")
+	ErrTokenAudience  = gerrors.New("token audience is invalid")
+)
+
+// JWTConfig Bearer JWT认证的配置
+// 验证签名的密钥依次从KeyProvider、JWKSFile、Secret和容器中绑定的geex:jwt_keys中获取
+type JWTConfig struct {
+	Realm       string                  // WWW-Authenticate中的realm，默认为"Restricted"
+	Algorithms  []string                // 允许的签名算法，默认为HS256、RS256和ES256
+	Secret      []byte                  // HS256的密钥
+	JWKSFile    string                  // 本地的JWKS文件
+	KeyProvider contract.JWTKeyProvider // 自定义的密钥来源
+	Issuer      string                  // 不为空时校验iss
+	Audience    string                  // 不为空时校验aud包含该值
+	Leeway      time.Duration           // 校验exp和nbf时允许的时钟误差
+	now         func() time.Time
+}
+
+// JWTAuth 使用HS256密钥校验Bearer JWT
+func JWTAuth(secret []byte) HandlerFunc {
+	return JWTAuthWithConfig(JWTConfig{Secret: secret})
+}
+
+// JWTAuthWithConfig 校验Authorization中的Bearer JWT，通过后以sub作为调用方保存全部claims
+// 失败时按RFC 6750返回带error的WWW-Authenticate
+// JWKSFile在创建中间件时加载，加载失败直接panic，只有容器中的密钥来源在第一个请求时获取
+func JWTAuthWithConfig(conf JWTConfig) HandlerFunc {
+	if conf.Realm == "" {
+		conf.Realm = "Restricted"
+	}
+	if len(conf.Algorithms) == 0 {
+		conf.Algorithms = []string{JWTAlgHS256, JWTAlgRS256, JWTAlgES256}
+	}
+	if conf.now == nil {
+		conf.now = time.Now
+	}
+	if err := conf.loadStaticKeys(); err != nil {
+		panic(err)
+	}
+	var once sync.Once
+	challenge := "Bearer realm=" + strconv.Quote(conf.Realm)
+	return func(c *Context) {
+		once.Do(func() {
+			if conf.KeyProvider == nil {
+				conf.KeyProvider = containerKeyProvider(c.container)
+			}
+			if conf.KeyProvider == nil {
+				log.Printf("[geex] WARNING: jwt: no key configured, bind %s or set JWTConfig keys", contract.JWTKeyProviderKey)
+			}
+		})
+		if conf.KeyProvider == nil {
+			errorResponse(c, http.StatusInternalServerError, "500 INTERNAL SERVER ERROR: jwt key not configured")
+			c.Abort()
+			return
+		}
+		auth := c.Req.Header.Get("Authorization")
+		if len(auth) < 7 || !strings.EqualFold(auth[:7], "Bearer ") {
+			unauthorized(c, challenge, "missing bearer token")
+			return
+		}
+		claims, err := conf.Parse(c, strings.TrimSpace(auth[7:]))
+		if err != nil {
+			desc := gerrors.Cause(err).Error()
+			unauthorized(c, challenge+`, error="invalid_token", error_description=`+strconv.Quote(desc), desc)
+			return
+		}
+		subject, _ := claims["sub"].(string)
+		c.setPrincipal(&Principal{Scheme: AuthSchemeBearer, Subject: subject, Claims: claims})
+		c.Next()
+	}
+}
+
+// loadStaticKeys 加载配置中直接给出的密钥，配置错误属于开发期错误
+func (conf *JWTConfig) loadStaticKeys() error {
+	switch {
+	case conf.KeyProvider != nil:
+	case conf.JWKSFile != "":
+		jwks, err := LoadJWKS(conf.JWKSFile)
+		if err != nil {
+			return err
+		}
+		conf.KeyProvider = jwks
+	case len(conf.Secret) > 0:
+		conf.KeyProvider = secretKey(conf.Secret)
+	}
+	return nil
+}
+
+// containerKeyProvider 容器中绑定的密钥来源，没有绑定时返回nil
+func containerKeyProvider(container Container) contract.JWTKeyProvider {
+	if container == nil || !container.IsBind(contract.JWTKeyProviderKey) {
+		return nil
+	}
+	provider, _ := container.MustMake(contract.JWTKeyProviderKey).(contract.JWTKeyProvider)
+	return provider
+}
+
+// secretKey 只提供HS256密钥的JWTKeyProvider
+type secretKey []byte
+
+func (s secretKey) Key(ctx context.Context, kid, alg string) (interface{}, error) {
+	return []byte(s), nil
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Parse 校验token的签名和claims，返回全部claims
+func (conf *JWTConfig) Parse(ctx context.Context, token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrTokenMalformed
+	}
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	allowed := false
+	for _, alg := range conf.Algorithms {
+		allowed = allowed || alg == header.Alg
+	}
+	if !allowed {
+		return nil, gerrors.Wrapf(ErrTokenSignature, "algorithm %q not allowed", header.Alg)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrTokenMalformed
+	}
+	if conf.KeyProvider == nil {
+		return nil, gerrors.Wrap(ErrTokenSignature, "no key configured")
+	}
+	key, err := conf.KeyProvider.Key(ctx, header.Kid, header.Alg)
+	if err != nil {
+		return nil, gerrors.Wrap(ErrTokenSignature, err.Error())
+	}
+	if err = verifySignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+	var claims map[string]interface{}
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if err = conf.validateClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return ErrTokenMalformed
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err = decoder.Decode(v); err != nil {
+		return ErrTokenMalformed
+	}
+	return nil
+}
+
+// verifySignature 校验签名，密钥类型必须与算法匹配，防止用公钥作为HMAC密钥伪造签名
+func verifySignature(alg string, key interface{}, signed string, signature []byte) error {
+	hash := sha256.Sum256([]byte(signed))
+	switch alg {
+	case JWTAlgHS256:
+		secret, ok := key.([]byte)
+		if !ok {
+			return gerrors.Wrap(ErrTokenSignature, "key type mismatch")
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return ErrTokenSignature
+		}
+	case JWTAlgRS256:
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return gerrors.Wrap(ErrTokenSignature, "key type mismatch")
+		}
+		if rsa.VerifyPKCS1v15(pub, crypto.SHA256, hash[:], signature) != nil {
+			return ErrTokenSignature
+		}
+	case JWTAlgES256:
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || pub.Curve != elliptic.P256() || len(signature) != 64 {
+			return ErrTokenSignature
+		}
+		r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(pub, hash[:], r, s) {
+			return ErrTokenSignature
+		}
+	default:
+		return gerrors.Wrapf(ErrTokenSignature, "unsupported algorithm %q", alg)
+	}
+	return nil
+}
+
+func (conf *JWTConfig) validateClaims(claims map[string]interface{}) error {
+	now := conf.now()
+	if exp, ok := numericClaim(claims, "exp"); ok && now.After(exp.Add(conf.Leeway)) {
+		return ErrTokenExpired
+	}
+	if nbf, ok := numericClaim(claims, "nbf"); ok && now.Add(conf.Leeway).Before(nbf) {
+		return ErrTokenNotValid
+	}
+	if conf.Issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != conf.Issuer {
+			return ErrTokenIssuer
+		}
+	}
+	if conf.Audience != "" && !hasAudience(claims["aud"], conf.Audience) {
+		return ErrTokenAudience
+	}
+	return nil
+}
+
+func numericClaim(claims map[string]interface{}, name string) (time.Time, bool) {
+	n, ok := claims[name].(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, int64(f*float64(time.Second))), true
+}
+
+// hasAudience aud可以是字符串或字符串数组
+func hasAudience(aud interface{}, expected string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == expected
+	case []interface{}:
+		for _, a := range v {
+			if s, ok := a.(string); ok && s == expected {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// JWKS JSON Web Key Set，实现contract.JWTKeyProvider
+type JWKS struct {
+	keys []jwk
+}
+
+type jwk struct {
+	kid string
+	alg string
+	key interface{}
+}
+
+var _ contract.JWTKeyProvider = &JWKS{}
+
+// LoadJWKS 从文件中加载JWKS，支持RSA、P-256的EC和oct类型的密钥
+func LoadJWKS(path string) (*JWKS, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, gerrors.WithStack(err)
+	}
+	return ParseJWKS(data)
+}
+
+// ParseJWKS 解析JWKS，不支持的密钥类型会被忽略
+func ParseJWKS(data []byte) (*JWKS, error) {
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Alg string `json:"alg"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+			K   string `json:"k"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, gerrors.Wrap(err, "parse jwks")
+	}
+	jwks := &JWKS{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		item := jwk{kid: k.Kid, alg: k.Alg}
+		switch k.Kty {
+		case "RSA":
+			n, err1 := base64.RawURLEncoding.DecodeString(k.N)
+			e, err2 := base64.RawURLEncoding.DecodeString(k.E)
+			if err1 != nil || err2 != nil {
+				return nil, gerrors.Errorf("parse jwks: invalid RSA key %q", k.Kid)
+			}
+			item.key = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+			if item.alg == "" {
+				item.alg = JWTAlgRS256
+			}
+		case "EC":
+			if k.Crv != "P-256" {
+				continue
+			}
+			x, err1 := base64.RawURLEncoding.DecodeString(k.X)
+			y, err2 := base64.RawURLEncoding.DecodeString(k.Y)
+			if err1 != nil || err2 != nil {
+				return nil, gerrors.Errorf("parse jwks: invalid EC key %q", k.Kid)
+			}
+			item.key = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+			if item.alg == "" {
+				item.alg = JWTAlgES256
+			}
+		case "oct":
+			secret, err := base64.RawURLEncoding.DecodeString(k.K)
+			if err != nil {
+				return nil, gerrors.Errorf("parse jwks: invalid oct key %q", k.Kid)
+			}
+			item.key = secret
+			if item.alg == "" {
+				item.alg = JWTAlgHS256
+			}
+		default:
+			continue
+		}
+		jwks.keys = append(jwks.keys, item)
+	}
+	return jwks, nil
+}
+
+// Key 按kid和alg查找密钥，token没有kid时使用第一个算法匹配的密钥
+func (s *JWKS) Key(ctx context.Context, kid, alg string) (interface{}, error) {
+	for _, k := range s.keys {
+		if k.alg == alg && (kid == "" || k.kid == kid) {
+			return k.key, nil
+		}
+	}
+	return nil, fmt.Errorf("no key for kid %q and alg %q", kid, alg)
+}
@@ -0,0 +1,160 @@
+package framework
+
+import (
+	"bytes"
+	"crypto/tls"
+	"github.com/fsnotify/fsnotify"
+	gerrors "github.com/pkg/errors"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// listenAndServe 监听options.Addr并提供服务
+func (e *Engine) listenAndServe(options ServerOptions) error {
+	l, err := net.Listen("tcp", options.Addr)
+	if err != nil {
+		return err
+	}
+	return serve(e.newServer(options), options, l)
+}
+
+// RunTLS 在addr上启动HTTPS服务，支持HTTP/2
+// certFile和keyFile为空时从配置服务的app.server.cert_file和app.server.key_file中读取
+// 证书文件变更后自动重新加载，不需要重启服务
+func (e *Engine) RunTLS(addr, certFile, keyFile string) error {
+	options := e.loadServerOptions(&ServerOptions{Addr: addr, CertFile: certFile, KeyFile: keyFile})
+	if options.CertFile == "" || options.KeyFile == "" {
+		return gerrors.New("run tls: cert file and key file are required")
+	}
+	return e.listenAndServe(options)
+}
+
+// RunListener 在已有的listener上启动HTTP服务，例如systemd传入的socket
+func (e *Engine) RunListener(l net.Listener) error {
+	options := e.loadServerOptions(&ServerOptions{Addr: l.Addr().String()})
+	options.CertFile, options.KeyFile = "", ""
+	return serve(e.newServer(options), options, l)
+}
+
+// RunUnix 在unix socket上启动HTTP服务，path上残留的socket文件会被删除
+func (e *Engine) RunUnix(path string) error {
+	if fi, err := os.Stat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return gerrors.Errorf("run unix: %s exists and is not a socket", path)
+		}
+		if err = os.Remove(path); err != nil {
+			return gerrors.Wrap(err, "run unix")
+		}
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return gerrors.Wrap(err, "run unix")
+	}
+	return e.RunListener(l)
+}
+
+// certReloader 持有当前的TLS证书，监控证书文件所在的文件夹，文件夹有变化时重新读取
+// 内容没有变化时不重新加载，加载失败时继续使用原来的证书
+type certReloader struct {
+	certFile string
+	keyFile  string
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	certPEM  []byte
+	keyPEM   []byte
+	watcher  *fsnotify.Watcher
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	certFile, err := filepath.Abs(certFile)
+	if err != nil {
+		return nil, gerrors.WithStack(err)
+	}
+	keyFile, err = filepath.Abs(keyFile)
+	if err != nil {
+		return nil, gerrors.WithStack(err)
+	}
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err = r.reload(); err != nil {
+		return nil, err
+	}
+	// 监控文件夹而不是文件，证书通常以重命名的方式整体替换
+	// Kubernetes挂载的Secret通过替换..data符号链接更新，不会产生证书文件本身的事件
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, gerrors.WithStack(err)
+	}
+	for _, dir := range []string{filepath.Dir(certFile), filepath.Dir(keyFile)} {
+		if err = watcher.Add(dir); err != nil {
+			watcher.Close()
+			return nil, gerrors.WithStack(err)
+		}
+	}
+	r.watcher = watcher
+	go r.watch()
+	return r, nil
+}
+
+func (r *certReloader) reload() error {
+	certPEM, err := ioutil.ReadFile(r.certFile)
+	if err != nil {
+		return gerrors.Wrap(err, "load certificate")
+	}
+	keyPEM, err := ioutil.ReadFile(r.keyFile)
+	if err != nil {
+		return gerrors.Wrap(err, "load certificate")
+	}
+	// 文件夹中其他文件的变化也会触发，内容相同时跳过
+	if bytes.Equal(certPEM, r.certPEM) && bytes.Equal(keyPEM, r.keyPEM) {
+		return nil
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return gerrors.Wrap(err, "load certificate")
+	}
+	r.certPEM, r.keyPEM = certPEM, keyPEM
+	r.mu.Lock()
+	r.cert = &cert
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *certReloader) watch() {
+	for {
+		select {
+		case ev, ok := <-r.watcher.Events:
+			if !ok {
+				return
+			}
+			// 证书文件可能是符号链接，链接指向的内容变化时只有文件夹中的其他文件有事件
+			if ev.Op&(fsnotify.Create|fsnotify.Write|fsnotify.Rename) == 0 {
+				continue
+			}
+			// 证书和私钥不是同时更新时，第一次加载会失败，等另一个文件更新后再加载
+			if err := r.reload(); err != nil {
+				log.Printf("[geex] WARNING: reload certificate failed: %v", err)
+			}
+		case err, ok := <-r.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("[geex] WARNING: watch certificate failed: %v", err)
+		}
+	}
+}
+
+// GetCertificate 用于tls.Config.GetCertificate
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// Close 停止监控证书文件
+func (r *certReloader) Close() error {
+	return r.watcher.Close()
+}
@@ -0,0 +1,217 @@
+package framework
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	c "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/net/http2"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeSelfSignedCert 生成127.0.0.1的自签名证书并写入dir，返回证书文件、私钥文件和证书
+func writeSelfSignedCert(t *testing.T, dir, commonName string) (string, string, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	// 先写到临时文件再重命名，模拟证书的整体替换
+	write := func(file, blockType string, data []byte) {
+		tmp := file + ".tmp"
+		if err := ioutil.WriteFile(tmp, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: data}), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(tmp, file); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(keyFile, "EC PRIVATE KEY", keyDer)
+	write(certFile, "CERTIFICATE", der)
+	return certFile, keyFile, cert
+}
+
+func newProtoEngine() *Engine {
+	engine := New()
+	engine.Get("/proto", func(ctx *Context) {
+		ctx.String(http.StatusOK, ctx.Req.Proto)
+	})
+	return engine
+}
+
+func getBody(client *http.Client, url string) (string, *http.Response, error) {
+	var (
+		resp *http.Response
+		err  error
+	)
+	for i := 0; i < 50; i++ {
+		if resp, err = client.Get(url); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	return string(body), resp, err
+}
+
+func TestRunTLS(t *testing.T) {
+	c.Convey("test tls with certificate reload", t, func() {
+		dir := t.TempDir()
+		certFile, keyFile, cert := writeSelfSignedCert(t, dir, "first")
+		engine := newProtoEngine()
+		addr := freeAddr(t)
+		errChan := make(chan error, 1)
+		go func() {
+			errChan <- engine.RunTLS(addr, certFile, keyFile)
+		}()
+		defer func() {
+			engine.Shutdown(context.Background())
+			<-errChan
+		}()
+
+		newClient := func(cert *x509.Certificate) *http.Client {
+			pool := x509.NewCertPool()
+			pool.AddCert(cert)
+			transport := &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}, ForceAttemptHTTP2: true}
+			return &http.Client{Transport: transport}
+		}
+		body, resp, err := getBody(newClient(cert), "https://"+addr+"/proto")
+		c.So(err, c.ShouldBeNil)
+		c.So(body, c.ShouldEqual, "HTTP/2.0")
+		c.So(resp.TLS.PeerCertificates[0].Subject.CommonName, c.ShouldEqual, "first")
+
+		_, _, cert = writeSelfSignedCert(t, dir, "second")
+		client := newClient(cert)
+		for i := 0; i < 100; i++ {
+			if _, resp, err = getBody(client, "https://"+addr+"/proto"); err == nil {
+				break
+			}
+			client.CloseIdleConnections()
+			time.Sleep(20 * time.Millisecond)
+		}
+		c.So(err, c.ShouldBeNil)
+		c.So(resp.TLS.PeerCertificates[0].Subject.CommonName, c.ShouldEqual, "second")
+	})
+}
+
+func TestCertReloaderSymlink(t *testing.T) {
+	c.Convey("test certificate reload through a swapped ..data symlink", t, func() {
+		// 模拟Kubernetes挂载Secret的目录结构: tls.crt -> ..data/tls.crt, ..data -> ..<版本>
+		dir := t.TempDir()
+		version := func(name string) *x509.Certificate {
+			versionDir := filepath.Join(dir, ".."+name)
+			c.So(os.Mkdir(versionDir, 0755), c.ShouldBeNil)
+			certFile, keyFile, cert := writeSelfSignedCert(t, versionDir, name)
+			c.So(os.Rename(certFile, filepath.Join(versionDir, "tls.crt")), c.ShouldBeNil)
+			c.So(os.Rename(keyFile, filepath.Join(versionDir, "tls.key")), c.ShouldBeNil)
+			c.So(os.Symlink(".."+name, filepath.Join(dir, "..data_tmp")), c.ShouldBeNil)
+			c.So(os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")), c.ShouldBeNil)
+			return cert
+		}
+		version("first")
+		for _, name := range []string{"tls.crt", "tls.key"} {
+			c.So(os.Symlink(filepath.Join("..data", name), filepath.Join(dir, name)), c.ShouldBeNil)
+		}
+		r, err := newCertReloader(filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"))
+		c.So(err, c.ShouldBeNil)
+		defer r.Close()
+		commonName := func() string {
+			cert, _ := r.GetCertificate(nil)
+			parsed, err := x509.ParseCertificate(cert.Certificate[0])
+			if err != nil {
+				return err.Error()
+			}
+			return parsed.Subject.CommonName
+		}
+		c.So(commonName(), c.ShouldEqual, "first")
+
+		version("second")
+		c.So(os.RemoveAll(filepath.Join(dir, "..first")), c.ShouldBeNil)
+		for i := 0; i < 100 && commonName() != "second"; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		c.So(commonName(), c.ShouldEqual, "second")
+	})
+}
+
+func TestRunUnix(t *testing.T) {
+	c.Convey("test unix socket listener", t, func() {
+		path := filepath.Join(t.TempDir(), "geex.sock")
+		engine := newProtoEngine()
+		errChan := make(chan error, 1)
+		go func() {
+			errChan <- engine.RunUnix(path)
+		}()
+		client := &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", path)
+			},
+		}}
+		body, _, err := getBody(client, "http://unix/proto")
+		c.So(err, c.ShouldBeNil)
+		c.So(body, c.ShouldEqual, "HTTP/1.1")
+		c.So(engine.Shutdown(context.Background()), c.ShouldBeNil)
+		c.So(<-errChan, c.ShouldEqual, http.ErrServerClosed)
+		_, err = os.Stat(path)
+		c.So(os.IsNotExist(err), c.ShouldBeTrue)
+	})
+}
+
+func TestH2C(t *testing.T) {
+	c.Convey("test h2c", t, func() {
+		engine := newProtoEngine()
+		addr := freeAddr(t)
+		errChan := make(chan error, 1)
+		go func() {
+			errChan <- engine.RunServer(&ServerOptions{Addr: addr, H2C: true})
+		}()
+		client := &http.Client{Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+				return net.Dial(network, addr)
+			},
+		}}
+		body, _, err := getBody(client, "http://"+addr+"/proto")
+		c.So(err, c.ShouldBeNil)
+		c.So(body, c.ShouldEqual, "HTTP/2.0")
+		c.So(engine.Shutdown(context.Background()), c.ShouldBeNil)
+		c.So(<-errChan, c.ShouldBeNil)
+	})
+}
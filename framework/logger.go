@@ -1,7 +1,9 @@
 package framework
 
 import (
+	"github.com/hiholder/geex/framework/contract"
 	"log"
+	"sync"
 	"time"
 )
 
@@ -12,6 +14,148 @@ func Logger() HandlerFunc {
 		// 处理请求
 		c.Next()
 		// Calculate resolution time
-		log.Printf("[%d] %s in %v", c.StatusCode, c.Req.RequestURI, time.Since(t))
+		log.Printf("[%d] %s in %v", c.Writer.Status(), c.Req.RequestURI, time.Since(t))
+	}
+}
+
+// 访问日志的字段
+const (
+	AccessFieldMethod    = "method"
+	AccessFieldPath      = "path"
+	AccessFieldRoute     = "route"
+	AccessFieldStatus    = "status"
+	AccessFieldBytes     = "bytes"
+	AccessFieldLatency   = "latency"
+	AccessFieldClientIP  = "client_ip"
+	AccessFieldUserAgent = "user_agent"
+	AccessFieldRequestID = "request_id"
+)
+
+var defaultAccessFields = []string{
+	AccessFieldMethod, AccessFieldPath, AccessFieldRoute, AccessFieldStatus, AccessFieldBytes,
+	AccessFieldLatency, AccessFieldClientIP, AccessFieldUserAgent, AccessFieldRequestID,
+}
+
+// AccessLogConfig 访问日志的配置，为零值的字段从配置服务的log.access.*中获取
+type AccessLogConfig struct {
+	SkipPaths     []string      // 不记录日志的路径，对应log.access.skip_paths
+	Fields        []string      // 输出的字段，为空时输出全部字段，对应log.access.fields
+	SlowThreshold time.Duration // 处理时间超过该值的请求以Warn级别记录，0表示不区分，对应log.access.slow_threshold
+}
+
+// AccessLog 使用容器中的日志服务记录访问日志
+func AccessLog() HandlerFunc {
+	return AccessLogWithConfig(AccessLogConfig{})
+}
+
+// AccessLogWithConfig 使用容器中的日志服务记录访问日志，每个请求输出一条结构化日志
+// 5xx响应以Error级别记录，慢请求以Warn级别记录，其他以Info级别记录
+// 容器中没有绑定日志服务时使用标准库log输出
+func AccessLogWithConfig(conf AccessLogConfig) HandlerFunc {
+	var (
+		once   sync.Once
+		logger contract.Log
+		skip   map[string]bool
+	)
+	return func(c *Context) {
+		// 服务通常在中间件创建之后才绑定，在第一个请求时获取
+		once.Do(func() {
+			logger, conf = loadAccessLog(c.container, conf)
+			skip = make(map[string]bool, len(conf.SkipPaths))
+			for _, path := range conf.SkipPaths {
+				skip[path] = true
+			}
+		})
+		if skip[c.Path] {
+			c.Next()
+			return
+		}
+		start := time.Now()
+		c.Next()
+		latency := time.Since(start)
+
+		fields := make(map[string]interface{}, len(conf.Fields))
+		for _, field := range conf.Fields {
+			fields[field] = accessField(c, field, latency)
+		}
+		status := c.Writer.Status()
+		if logger == nil {
+			log.Printf("[geex] access %v", fields)
+			return
+		}
+		switch {
+		case status >= 500:
+			logger.CtxError(c, "access", fields)
+		case conf.SlowThreshold > 0 && latency > conf.SlowThreshold:
+			logger.CtxWarn(c, "slow access", fields)
+		default:
+			logger.CtxInfo(c, "access", fields)
+		}
+	}
+}
+
+// loadAccessLog 获取日志服务，并用配置服务补全conf中为零值的字段
+func loadAccessLog(container Container, conf AccessLogConfig) (contract.Log, AccessLogConfig) {
+	logger := logService(container)
+	if container.IsBind(contract.ConfigKey) {
+		if config, ok := container.MustMake(contract.ConfigKey).(contract.Config); ok {
+			if conf.SkipPaths == nil && config.IsExist("log.access.skip_paths") {
+				conf.SkipPaths = config.GetStringSlice("log.access.skip_paths")
+			}
+			if conf.Fields == nil && config.IsExist("log.access.fields") {
+				conf.Fields = config.GetStringSlice("log.access.fields")
+			}
+			if conf.SlowThreshold == 0 && config.IsExist("log.access.slow_threshold") {
+				d, err := time.ParseDuration(config.GetString("log.access.slow_threshold"))
+				if err != nil {
+					log.Printf("[geex] WARNING: invalid duration log.access.slow_threshold=%v: %v", config.Get("log.access.slow_threshold"), err)
+				}
+				conf.SlowThreshold = d
+			}
+		}
+	}
+	if len(conf.Fields) == 0 {
+		conf.Fields = defaultAccessFields
+	}
+	return logger, conf
+}
+
+// logService 获取容器中的日志服务，没有绑定时返回nil
+func logService(container Container) contract.Log {
+	if container == nil || !container.IsBind(contract.LogKey) {
+		return nil
+	}
+	logger, _ := container.MustMake(contract.LogKey).(contract.Log)
+	return logger
+}
+
+func accessField(c *Context, field string, latency time.Duration) interface{} {
+	switch field {
+	case AccessFieldMethod:
+		return c.Method
+	case AccessFieldPath:
+		return c.Path
+	case AccessFieldRoute:
+		return c.FullPath()
+	case AccessFieldStatus:
+		return c.Writer.Status()
+	case AccessFieldBytes:
+		if size := c.Writer.Size(); size > 0 {
+			return size
+		}
+		return 0
+	case AccessFieldLatency:
+		return latency
+	case AccessFieldClientIP:
+		return c.ClientIP()
+	case AccessFieldUserAgent:
+		return c.Req.UserAgent()
+	case AccessFieldRequestID:
+		if id := c.RequestID(); id != "" {
+			return id
+		}
+		return c.Req.Header.Get(HeaderRequestID)
+	default:
+		return nil
 	}
 }
@@ -0,0 +1,127 @@
+package framework
+
+import (
+	"context"
+	"github.com/hiholder/geex/framework/contract"
+	c "github.com/smartystreets/goconvey/convey"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// instanceProvider 直接返回给定实例的服务提供者
+type instanceProvider struct {
+	name     string
+	instance interface{}
+}
+
+func (p instanceProvider) Name() string { return p.name }
+func (p instanceProvider) Register(Container) NewInstance {
+	return func(...interface{}) (interface{}, error) { return p.instance, nil }
+}
+func (p instanceProvider) Params(Container) []interface{} { return nil }
+func (p instanceProvider) IsDefer() bool                  { return false }
+func (p instanceProvider) Boot(Container) error           { return nil }
+
+type logEntry struct {
+	level  contract.LogLevel
+	msg    string
+	fields map[string]interface{}
+	user   interface{} // 记录日志时从ctx中读取，请求结束后Context会被复用
+}
+
+// recordLog 记录日志内容的contract.Log实现
+type recordLog struct {
+	entries []logEntry
+}
+
+func (l *recordLog) add(level contract.LogLevel, ctx context.Context, msg string, fields map[string]interface{}) {
+	l.entries = append(l.entries, logEntry{level: level, msg: msg, fields: fields, user: ctx.Value("user")})
+}
+
+func (l *recordLog) CtxFatal(ctx context.Context, msg string, fields map[string]interface{}) {
+	l.add(contract.FatalLevel, ctx, msg, fields)
+}
+func (l *recordLog) CtxError(ctx context.Context, msg string, fields map[string]interface{}) {
+	l.add(contract.ErrorLevel, ctx, msg, fields)
+}
+func (l *recordLog) CtxWarn(ctx context.Context, msg string, fields map[string]interface{}) {
+	l.add(contract.WarnLevel, ctx, msg, fields)
+}
+func (l *recordLog) CtxInfo(ctx context.Context, msg string, fields map[string]interface{}) {
+	l.add(contract.InfoLevel, ctx, msg, fields)
+}
+func (l *recordLog) CtxDebug(ctx context.Context, msg string, fields map[string]interface{}) {
+	l.add(contract.DebugLevel, ctx, msg, fields)
+}
+func (l *recordLog) CtxTrace(ctx context.Context, msg string, fields map[string]interface{}) {
+	l.add(contract.TraceLevel, ctx, msg, fields)
+}
+func (l *recordLog) SetLevel(contract.LogLevel)         {}
+func (l *recordLog) SetFields(contract.CtxFields)       {}
+func (l *recordLog) SetFormatter(contract.CtxFormatter) {}
+func (l *recordLog) SetOutput(io.Writer)                {}
+
+func TestAccessLog(t *testing.T) {
+	c.Convey("test access log", t, func() {
+		engine := New()
+		logger := &recordLog{}
+		c.So(engine.Bind(instanceProvider{name: contract.LogKey, instance: logger}), c.ShouldBeNil)
+		engine.Use(AccessLogWithConfig(AccessLogConfig{
+			SkipPaths:     []string{"/health"},
+			SlowThreshold: 20 * time.Millisecond,
+		}))
+		engine.Get("/user/:id", func(ctx *Context) {
+			ctx.Set("user", "geex")
+			ctx.String(http.StatusOK, "hello")
+		})
+		engine.Get("/slow", func(ctx *Context) {
+			time.Sleep(30 * time.Millisecond)
+			ctx.Status(http.StatusNoContent)
+		})
+		engine.Get("/error", func(ctx *Context) {
+			ctx.Fail(http.StatusInternalServerError, "boom")
+		})
+		engine.Get("/health", func(ctx *Context) {
+			ctx.String(http.StatusOK, "ok")
+		})
+
+		r := httptest.NewRequest(http.MethodGet, "/user/42", nil)
+		r.Header.Set("User-Agent", "geex-test")
+		r.Header.Set("X-Request-ID", "req-1")
+		engine.ServeHTTP(httptest.NewRecorder(), r)
+		for _, path := range []string{"/slow", "/error", "/health"} {
+			engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+		}
+
+		c.So(logger.entries, c.ShouldHaveLength, 3)
+		entry := logger.entries[0]
+		c.So(entry.level, c.ShouldEqual, contract.InfoLevel)
+		c.So(entry.fields[AccessFieldMethod], c.ShouldEqual, http.MethodGet)
+		c.So(entry.fields[AccessFieldPath], c.ShouldEqual, "/user/42")
+		c.So(entry.fields[AccessFieldRoute], c.ShouldEqual, "/user/:id")
+		c.So(entry.fields[AccessFieldStatus], c.ShouldEqual, http.StatusOK)
+		c.So(entry.fields[AccessFieldBytes], c.ShouldEqual, 5)
+		c.So(entry.fields[AccessFieldClientIP], c.ShouldEqual, "192.0.2.1")
+		c.So(entry.fields[AccessFieldUserAgent], c.ShouldEqual, "geex-test")
+		c.So(entry.fields[AccessFieldRequestID], c.ShouldEqual, "req-1")
+		c.So(entry.user, c.ShouldEqual, "geex")
+		c.So(logger.entries[1].level, c.ShouldEqual, contract.WarnLevel)
+		c.So(logger.entries[2].level, c.ShouldEqual, contract.ErrorLevel)
+	})
+
+	c.Convey("test access log fields", t, func() {
+		engine := New()
+		logger := &recordLog{}
+		c.So(engine.Bind(instanceProvider{name: contract.LogKey, instance: logger}), c.ShouldBeNil)
+		engine.Use(AccessLogWithConfig(AccessLogConfig{Fields: []string{AccessFieldPath, AccessFieldStatus}}))
+		engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/missing", nil))
+		c.So(logger.entries, c.ShouldHaveLength, 1)
+		c.So(logger.entries[0].fields, c.ShouldResemble, map[string]interface{}{
+			AccessFieldPath:   "/missing",
+			AccessFieldStatus: http.StatusNotFound,
+		})
+	})
+}
@@ -31,6 +31,7 @@ type GeexConfig struct {
 	confRaw  map[string][]byte	// 配置文件原始信息
 	remoteProviders []*defaultRemoteProvider
 	remoteConfigProvider *remoteConfigProvider
+	watcher  *fsnotify.Watcher	// 配置文件夹的监控
 }
 
 type remoteConfigProvider struct {}
@@ -81,8 +82,10 @@ func NewGeexConfig(params ...interface{}) (interface{}, error) {
 		return nil, gerrors.WithStack(err)
 	}
 	if err = watcher.Add(envFolder); err != nil {
+		watcher.Close()
 		return nil, gerrors.WithStack(err)
 	}
+	geexConfig.watcher = watcher
 	go func() {
 		defer func() {
 			if err := recover(); err != nil {
@@ -91,8 +94,12 @@ func NewGeexConfig(params ...interface{}) (interface{}, error) {
 		}()
 		for {
 			select {
-			case ev := <- watcher.Events:
+			case ev, ok := <- watcher.Events:
 				{
+					// 监控已关闭
+					if !ok {
+						return
+					}
 					path, _ := filepath.Abs(ev.Name)
 					index := strings.LastIndex(path, string(os.PathSeparator))
 					folder := path[:index]
@@ -110,8 +117,11 @@ func NewGeexConfig(params ...interface{}) (interface{}, error) {
 						geexConfig.removeConfigFile(folder, fileName)
 					}
 				}
-			case err := <- watcher.Errors:
+			case err, ok := <- watcher.Errors:
 				{
+					if !ok {
+						return
+					}
 					logrus.Errorf("watch dir err: %v", err)
 					return
 				}
@@ -121,6 +131,14 @@ func NewGeexConfig(params ...interface{}) (interface{}, error) {
 	return geexConfig, nil
 }
 
+// Close 停止监控配置文件夹
+func (conf *GeexConfig) Close() error {
+	if conf.watcher == nil {
+		return nil
+	}
+	return conf.watcher.Close()
+}
+
 func (conf *GeexConfig)loadConfigFile(folder string, file string) error {
 	conf.lock.Lock()
 	defer conf.lock.Unlock()
@@ -14,9 +14,9 @@ type GeexLogServiceProvider struct {
 	Driver    string
 	// 日志级别
 	Level     contract.LogLevel
-	// 日志输出格式方法
+	// 日志context上下文信息获取函数，为空时使用framework.TraceCtxFields
 	CtxFields contract.CtxFields
-	// 日志context上下文信息获取函数
+	// 日志输出格式方法
 	Formatter contract.CtxFormatter
 	// 日志输出信息
 	Output io.Writer
@@ -62,6 +62,9 @@ func (g *GeexLogServiceProvider) Params(c framework.Container) []interface{} {
 			}
 		}
 	}
+	if g.CtxFields == nil {
+		g.CtxFields = framework.TraceCtxFields
+	}
 	if g.Level == contract.UnknownLevel {
 		g.Level = contract.InfoLevel
 		if config.IsExist("log.level") {
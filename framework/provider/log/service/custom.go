@@ -23,4 +23,9 @@ func NewGeexCustomLog(params ...interface{}) (interface{}, error) {
 	log.SetOutput(output)
 	log.c = c
 	return log, nil
-}
\ No newline at end of file
+}
+
+// Close 输出由调用方传入，由调用方负责关闭
+func (log *GeexCustomLog) Close() error {
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/hiholder/geex/framework/contract"
 	"github.com/hiholder/geex/framework/provider/log/formatter"
 	"io"
+	"os"
 	"time"
 )
 
@@ -36,6 +37,17 @@ func (log *GeexLog) SetOutput(writer io.Writer) {
 	log.output = writer
 }
 
+// Close 关闭日志输出，标准输出和标准错误不会被关闭
+func (log *GeexLog) Close() error {
+	if log.output == os.Stdout || log.output == os.Stderr {
+		return nil
+	}
+	if closer, ok := log.output.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
 func (log *GeexLog) CtxError(ctx context.Context, msg string, fields map[string]interface{}) {
 	log.logf(contract.ErrorLevel, ctx, msg, fields)
 }
@@ -68,6 +80,9 @@ func (log *GeexLog) logf(level contract.LogLevel, ctx context.Context, msg strin
 	// 将上下文参数填充到fields中
 	if fd := log.ctxFields; fd != nil {
 		t := log.ctxFields(ctx)
+		if fields == nil && len(t) > 0 {
+			fields = make(map[string]interface{}, len(t))
+		}
 		for k, v := range t {
 			fields[k] = v
 		}
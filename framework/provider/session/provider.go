@@ -0,0 +1,65 @@
+package session
+
+import (
+	"github.com/hiholder/geex/framework"
+	"github.com/hiholder/geex/framework/contract"
+	gerrors "github.com/pkg/errors"
+	"path/filepath"
+	"strings"
+)
+
+// GeexSessionProvider 提供服务端的会话存储，绑定后Sessions中间件不再把数据保存在cookie中
+type GeexSessionProvider struct {
+	// 存储驱动，memory或file，为空时读取session.driver配置，默认为memory
+	Driver string
+	// file驱动保存会话的目录，为空时使用RuntimeFolder下的session目录
+	Folder string
+}
+
+func (g *GeexSessionProvider) Name() string {
+	return contract.SessionKey
+}
+
+func (g *GeexSessionProvider) Register(c framework.Container) framework.NewInstance {
+	return NewGeexSessionStore
+}
+
+func (g *GeexSessionProvider) Params(c framework.Container) []interface{} {
+	if g.Driver == "" && c.IsBind(contract.ConfigKey) {
+		config := c.MustMake(contract.ConfigKey).(contract.Config)
+		g.Driver = strings.ToLower(config.GetString("session.driver"))
+		if g.Folder == "" {
+			g.Folder = config.GetString("session.folder")
+		}
+	}
+	if g.Driver == "file" && g.Folder == "" {
+		app := c.MustMake(contract.AppKey).(contract.App)
+		g.Folder = filepath.Join(app.RuntimeFolder(), "session")
+	}
+	return []interface{}{g.Driver, g.Folder}
+}
+
+func (g *GeexSessionProvider) IsDefer() bool {
+	return true
+}
+
+func (g *GeexSessionProvider) Boot(c framework.Container) error {
+	return nil
+}
+
+// NewGeexSessionStore 按驱动创建会话存储，参数为驱动和file驱动的目录
+func NewGeexSessionStore(params ...interface{}) (interface{}, error) {
+	if len(params) != 2 {
+		return nil, gerrors.New("params error")
+	}
+	driver, _ := params[0].(string)
+	folder, _ := params[1].(string)
+	switch driver {
+	case "", "memory":
+		return framework.NewMemorySessionStore(), nil
+	case "file":
+		return framework.NewFileSessionStore(folder)
+	default:
+		return nil, gerrors.Errorf("unknown session driver: %s", driver)
+	}
+}
@@ -0,0 +1,203 @@
+package framework
+
+import (
+	gerrors "github.com/pkg/errors"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// SetTrustedProxies 设置可信代理的IP或CIDR，只有连接对端在其中时才读取代理添加的请求头
+// 默认不信任任何代理，ClientIP、Scheme和Host只使用连接本身的信息
+func (e *Engine) SetTrustedProxies(proxies []string) error {
+	nets := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		proxy = strings.TrimSpace(proxy)
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return gerrors.Errorf("invalid trusted proxy: %q", proxy)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return gerrors.Wrapf(err, "invalid trusted proxy: %q", proxy)
+		}
+		nets = append(nets, ipNet)
+	}
+	e.trustedProxies = nets
+	return nil
+}
+
+// isTrustedProxy ip为空或不合法时不可信
+func (e *Engine) isTrustedProxy(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, ipNet := range e.trustedProxies {
+		if ipNet.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteIP 连接对端的IP
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(strings.TrimSpace(r.RemoteAddr))
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// fromTrustedProxy 请求是否由可信代理转发
+func (c *Context) fromTrustedProxy() bool {
+	return c.engine != nil && len(c.engine.trustedProxies) > 0 && c.engine.isTrustedProxy(remoteIP(c.Req))
+}
+
+// forwardedHop 代理链中的一跳，来自Forwarded的一个元素或X-Forwarded-*
+type forwardedHop struct {
+	ip    string
+	proto string
+	host  string
+}
+
+// clientHop 从右向左跳过可信代理，第一个不可信的地址即为客户端
+// 优先使用RFC 7239的Forwarded，其次为X-Forwarded-For，最后为X-Real-IP
+// X-Forwarded-Proto和X-Forwarded-Host与X-Forwarded-For一一对应时取客户端那一跳的值，否则取最右边可信代理添加的值
+func (c *Context) clientHop() (forwardedHop, bool) {
+	if !c.fromTrustedProxy() {
+		return forwardedHop{}, false
+	}
+	header := c.Req.Header
+	if values := header.Values("Forwarded"); len(values) > 0 {
+		if hops := parseForwarded(values); len(hops) > 0 {
+			return hops[c.firstUntrusted(hops)], true
+		}
+	}
+	if values := header.Values("X-Forwarded-For"); len(values) > 0 {
+		var hops []forwardedHop
+		for _, value := range values {
+			for _, ip := range strings.Split(value, ",") {
+				hops = append(hops, forwardedHop{ip: forwardedIP(ip)})
+			}
+		}
+		i := c.firstUntrusted(hops)
+		hop := hops[i]
+		hop.proto = strings.ToLower(forwardedValue(header.Values("X-Forwarded-Proto"), len(hops), i))
+		hop.host = forwardedValue(header.Values("X-Forwarded-Host"), len(hops), i)
+		return hop, true
+	}
+	hop := forwardedHop{
+		proto: strings.ToLower(forwardedValue(header.Values("X-Forwarded-Proto"), 1, 0)),
+		host:  forwardedValue(header.Values("X-Forwarded-Host"), 1, 0),
+	}
+	if ip := net.ParseIP(strings.TrimSpace(header.Get("X-Real-IP"))); ip != nil {
+		hop.ip = ip.String()
+	}
+	return hop, true
+}
+
+// firstUntrusted 第一个不可信的一跳的下标，全部为可信代理时返回最左边的一跳
+func (c *Context) firstUntrusted(hops []forwardedHop) int {
+	for i := len(hops) - 1; i > 0; i-- {
+		if !c.engine.isTrustedProxy(hops[i].ip) {
+			return i
+		}
+	}
+	return 0
+}
+
+// parseForwarded 解析Forwarded请求头，例如 for=192.0.2.60;proto=https, for="[2001:db8::1]:4711"
+func parseForwarded(values []string) []forwardedHop {
+	var hops []forwardedHop
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			var hop forwardedHop
+			for _, pair := range strings.Split(element, ";") {
+				i := strings.IndexByte(pair, '=')
+				if i < 0 {
+					continue
+				}
+				key := strings.ToLower(strings.TrimSpace(pair[:i]))
+				val := strings.Trim(strings.TrimSpace(pair[i+1:]), `"`)
+				switch key {
+				case "for":
+					hop.ip = forwardedIP(val)
+				case "proto":
+					hop.proto = strings.ToLower(val)
+				case "host":
+					hop.host = val
+				}
+			}
+			hops = append(hops, hop)
+		}
+	}
+	return hops
+}
+
+// forwardedIP 去掉端口和IPv6的方括号，unknown和混淆的标识返回空
+func forwardedIP(value string) string {
+	value = strings.TrimSpace(value)
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		value = host
+	}
+	value = strings.TrimSuffix(strings.TrimPrefix(value, "["), "]")
+	if ip := net.ParseIP(value); ip != nil {
+		return ip.String()
+	}
+	return ""
+}
+
+// forwardedValue 逗号分隔的多个请求头的值共有n个时返回第i个，否则返回最右边的值
+// 最左边的值可能是客户端伪造的，不能使用
+func forwardedValue(values []string, n, i int) string {
+	var list []string
+	for _, value := range values {
+		for _, v := range strings.Split(value, ",") {
+			list = append(list, strings.TrimSpace(v))
+		}
+	}
+	if len(list) == 0 {
+		return ""
+	}
+	if len(list) == n {
+		return list[i]
+	}
+	return list[len(list)-1]
+}
+
+// ClientIP 客户端的IP，连接来自可信代理时从代理添加的请求头中获取
+func (c *Context) ClientIP() string {
+	if hop, ok := c.clientHop(); ok && hop.ip != "" {
+		return hop.ip
+	}
+	return remoteIP(c.Req)
+}
+
+// Scheme 客户端请求使用的协议，http或https
+func (c *Context) Scheme() string {
+	if hop, ok := c.clientHop(); ok && (hop.proto == "http" || hop.proto == "https") {
+		return hop.proto
+	}
+	if c.Req.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// Host 客户端请求的Host，可能包含端口
+func (c *Context) Host() string {
+	if hop, ok := c.clientHop(); ok && hop.host != "" {
+		return hop.host
+	}
+	return c.Req.Host
+}
@@ -0,0 +1,61 @@
+package framework
+
+import (
+	"crypto/tls"
+	c "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTrustedProxies(t *testing.T) {
+	c.Convey("test client ip, scheme and host behind proxies", t, func() {
+		engine := New()
+		c.So(engine.SetTrustedProxies([]string{"10.0.0.0/8", "2001:db8::1", "bad"}), c.ShouldNotBeNil)
+		c.So(engine.SetTrustedProxies([]string{"10.0.0.0/8", "2001:db8::1"}), c.ShouldBeNil)
+		engine.Get("/", func(ctx *Context) {
+			ctx.String(http.StatusOK, "%s %s %s", ctx.ClientIP(), ctx.Scheme(), ctx.Host())
+		})
+		do := func(remote string, header map[string]string) string {
+			r := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+			r.RemoteAddr = remote
+			for k, v := range header {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, r)
+			return w.Body.String()
+		}
+
+		// 不可信的对端伪造的请求头被忽略
+		c.So(do("203.0.113.9:1234", map[string]string{
+			"X-Forwarded-For": "1.1.1.1", "X-Forwarded-Proto": "https", "X-Forwarded-Host": "evil.com",
+		}), c.ShouldEqual, "203.0.113.9 http example.com")
+
+		// 客户端伪造的最左侧地址被跳过，取第一个不可信的地址
+		c.So(do("10.0.0.2:1234", map[string]string{
+			"X-Forwarded-For": "6.6.6.6, 198.51.100.7, 10.0.0.3", "X-Forwarded-Proto": "https", "X-Forwarded-Host": "shop.com",
+		}), c.ShouldEqual, "198.51.100.7 https shop.com")
+
+		// X-Forwarded-Proto和X-Forwarded-Host中客户端伪造的最左侧值同样被跳过
+		c.So(do("10.0.0.2:1234", map[string]string{
+			"X-Forwarded-For": "6.6.6.6, 198.51.100.7", "X-Forwarded-Proto": "https, http", "X-Forwarded-Host": "evil.com, shop.com",
+		}), c.ShouldEqual, "198.51.100.7 http shop.com")
+		c.So(do("10.0.0.2:1234", map[string]string{
+			"X-Forwarded-For": "198.51.100.7", "X-Forwarded-Proto": "https, HTTP", "X-Forwarded-Host": "evil.com, shop.com",
+		}), c.ShouldEqual, "198.51.100.7 http shop.com")
+
+		c.So(do("[2001:db8::1]:443", map[string]string{
+			"Forwarded": `for=6.6.6.6;proto=http, for="[2001:db8:cafe::17]:4711";proto=https;host=api.com, for=10.0.0.3`,
+		}), c.ShouldEqual, "2001:db8:cafe::17 https api.com")
+
+		c.So(do("10.0.0.2:1234", map[string]string{"X-Real-IP": "198.51.100.8"}), c.ShouldEqual, "198.51.100.8 http example.com")
+		c.So(do("10.0.0.2:1234", nil), c.ShouldEqual, "10.0.0.2 http example.com")
+
+		r := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+		r.TLS = &tls.ConnectionState{}
+		ctx := newContext(httptest.NewRecorder(), r)
+		c.So(ctx.Scheme(), c.ShouldEqual, "https")
+		c.So(ctx.ClientIP(), c.ShouldEqual, "192.0.2.1")
+	})
+}
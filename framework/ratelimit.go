@@ -0,0 +1,249 @@
+package framework
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"github.com/hiholder/geex/framework/contract"
+	gerrors "github.com/pkg/errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const defaultRateLimitMaxKeys = 10000
+
+// RateLimitConfig 限流中间件的配置
+type RateLimitConfig struct {
+	Limit     int                     // Window内允许的请求数
+	Window    time.Duration           // 时间窗口
+	Algorithm string                  // 限流算法，默认为contract.RateLimitTokenBucket
+	KeyFunc   func(c *Context) string // 限流的维度，默认按客户端IP
+	Store     contract.RateLimitStore // 为空时使用容器中绑定的geex:ratelimit，没有绑定时使用内存存储
+	MaxKeys   int                     // 默认内存存储最多保存的key数量，超出时淘汰最久未使用的，默认为10000
+	OnLimited HandlerFunc             // 被限流时的处理函数，默认返回429
+}
+
+// RateLimitByIP 按客户端IP限流，位于可信代理之后时使用代理转发的客户端IP
+func RateLimitByIP(c *Context) string {
+	return c.ClientIP()
+}
+
+// RateLimitByRoute 按路由限流，所有客户端共享同一个额度
+func RateLimitByRoute(c *Context) string {
+	return c.Method + " " + c.FullPath()
+}
+
+// RateLimitByHeader 按请求头限流，例如API key，请求头为空时按客户端IP限流
+func RateLimitByHeader(name string) func(c *Context) string {
+	return func(c *Context) string {
+		if value := c.Req.Header.Get(name); value != "" {
+			return name + "=" + value
+		}
+		return RateLimitByIP(c)
+	}
+}
+
+// RateLimit 按客户端IP限流，window内最多允许limit个请求
+func RateLimit(limit int, window time.Duration) HandlerFunc {
+	return RateLimitWithConfig(RateLimitConfig{Limit: limit, Window: window})
+}
+
+// RateLimitWithConfig 按配置限流，响应中返回RateLimit-Limit、RateLimit-Remaining和RateLimit-Reset
+// 被限流时额外返回Retry-After，存储出错时放行请求
+func RateLimitWithConfig(conf RateLimitConfig) HandlerFunc {
+	if conf.Limit <= 0 || conf.Window <= 0 {
+		panic("ratelimit: limit and window must be positive")
+	}
+	if conf.Algorithm == "" {
+		conf.Algorithm = contract.RateLimitTokenBucket
+	}
+	if conf.Algorithm != contract.RateLimitTokenBucket && conf.Algorithm != contract.RateLimitSlidingWindow {
+		panic("ratelimit: unsupported algorithm " + conf.Algorithm)
+	}
+	if conf.KeyFunc == nil {
+		conf.KeyFunc = RateLimitByIP
+	}
+	if conf.OnLimited == nil {
+		conf.OnLimited = tooManyRequests
+	}
+	var once sync.Once
+	return func(c *Context) {
+		once.Do(func() {
+			if conf.Store != nil {
+				return
+			}
+			if c.container != nil && c.container.IsBind(contract.RateLimitKey) {
+				conf.Store, _ = c.container.MustMake(contract.RateLimitKey).(contract.RateLimitStore)
+			}
+			if conf.Store == nil {
+				conf.Store = NewMemoryRateLimitStore(conf.MaxKeys)
+			}
+		})
+		result, err := conf.Store.Take(c, conf.KeyFunc(c), conf.Algorithm, conf.Limit, conf.Window)
+		if err != nil {
+			log.Printf("[geex] WARNING: rate limit store failed: %v", err)
+			c.Next()
+			return
+		}
+		header := c.Writer.Header()
+		header.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+		header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		header.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+		if !result.Allowed {
+			header.Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			c.Abort()
+			conf.OnLimited(c)
+			return
+		}
+		c.Next()
+	}
+}
+
+func tooManyRequests(c *Context) {
+	errorResponse(c, http.StatusTooManyRequests, "429 TOO MANY REQUESTS")
+}
+
+func ceilSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int(math.Ceil(d.Seconds()))
+}
+
+// MemoryRateLimitStore 单机的限流存储，key数量超过上限时淘汰最久未使用的
+type MemoryRateLimitStore struct {
+	mu      sync.Mutex
+	maxKeys int
+	entries map[string]*list.Element
+	lru     *list.List
+	now     func() time.Time
+}
+
+var _ contract.RateLimitStore = &MemoryRateLimitStore{}
+
+// rateLimitEntry 一个key的限流状态，令牌桶使用tokens和last，滑动窗口使用windowStart、prev和curr
+type rateLimitEntry struct {
+	key         string
+	tokens      float64
+	last        time.Time
+	windowStart time.Time
+	prev        int
+	curr        int
+}
+
+// NewMemoryRateLimitStore 创建内存存储，maxKeys小于等于0时使用默认值10000
+func NewMemoryRateLimitStore(maxKeys int) *MemoryRateLimitStore {
+	if maxKeys <= 0 {
+		maxKeys = defaultRateLimitMaxKeys
+	}
+	return &MemoryRateLimitStore{
+		maxKeys: maxKeys,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+		now:     time.Now,
+	}
+}
+
+func (s *MemoryRateLimitStore) Take(ctx context.Context, key string, algorithm string, limit int, window time.Duration) (contract.RateLimitResult, error) {
+	// 不同配置的限流器可能共用一个存储，key中带上配置避免互相影响
+	key = fmt.Sprintf("%s|%d|%s|%s", algorithm, limit, window, key)
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, isNew := s.entry(key)
+	switch algorithm {
+	case contract.RateLimitTokenBucket:
+		if isNew {
+			entry.tokens, entry.last = float64(limit), now
+		}
+		return entry.takeToken(now, limit, window), nil
+	case contract.RateLimitSlidingWindow:
+		if isNew {
+			entry.windowStart = now
+		}
+		return entry.takeWindow(now, limit, window), nil
+	default:
+		return contract.RateLimitResult{}, gerrors.Errorf("unsupported rate limit algorithm %s", algorithm)
+	}
+}
+
+// Len 当前保存的key数量
+func (s *MemoryRateLimitStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lru.Len()
+}
+
+func (s *MemoryRateLimitStore) entry(key string) (*rateLimitEntry, bool) {
+	if el, ok := s.entries[key]; ok {
+		s.lru.MoveToFront(el)
+		return el.Value.(*rateLimitEntry), false
+	}
+	if s.lru.Len() >= s.maxKeys {
+		oldest := s.lru.Back()
+		s.lru.Remove(oldest)
+		delete(s.entries, oldest.Value.(*rateLimitEntry).key)
+	}
+	entry := &rateLimitEntry{key: key}
+	s.entries[key] = s.lru.PushFront(entry)
+	return entry, true
+}
+
+// takeToken 令牌桶，容量为limit，每window/limit恢复一个令牌
+func (e *rateLimitEntry) takeToken(now time.Time, limit int, window time.Duration) contract.RateLimitResult {
+	// 恢复一个令牌需要的时间
+	interval := float64(window) / float64(limit)
+	e.tokens = math.Min(float64(limit), e.tokens+float64(now.Sub(e.last))/interval)
+	e.last = now
+	result := contract.RateLimitResult{Limit: limit}
+	if e.tokens >= 1 {
+		e.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration(math.Ceil((1 - e.tokens) * interval))
+	}
+	result.Remaining = int(e.tokens)
+	result.Reset = time.Duration(math.Ceil((float64(limit) - e.tokens) * interval))
+	return result
+}
+
+// takeWindow 滑动窗口计数，最近window内的请求数估算为prev*(1-elapsed/window)+curr
+func (e *rateLimitEntry) takeWindow(now time.Time, limit int, window time.Duration) contract.RateLimitResult {
+	if elapsed := now.Sub(e.windowStart); elapsed >= window {
+		windows := int(elapsed / window)
+		if windows == 1 {
+			e.prev = e.curr
+		} else {
+			e.prev = 0
+		}
+		e.curr = 0
+		e.windowStart = e.windowStart.Add(time.Duration(windows) * window)
+	}
+	elapsed := now.Sub(e.windowStart)
+	weight := 1 - float64(elapsed)/float64(window)
+	estimate := float64(e.prev)*weight + float64(e.curr)
+	result := contract.RateLimitResult{Limit: limit, Reset: window - elapsed}
+	if estimate+1 <= float64(limit) {
+		e.curr++
+		estimate++
+		result.Allowed = true
+	} else if e.curr+1 > limit || e.prev == 0 {
+		// 当前窗口已经用完，等到下一个窗口
+		result.RetryAfter = window - elapsed
+	} else {
+		// 等到上一个窗口的权重下降到可以再放行一个请求
+		need := (float64(limit) - 1 - float64(e.curr)) / float64(e.prev)
+		result.RetryAfter = time.Duration((1-need)*float64(window)) - elapsed
+	}
+	if remaining := limit - int(math.Ceil(estimate)); remaining > 0 {
+		result.Remaining = remaining
+	}
+	if result.RetryAfter < 0 {
+		result.RetryAfter = 0
+	}
+	return result
+}
@@ -0,0 +1,139 @@
+package framework
+
+import (
+	"context"
+	"github.com/hiholder/geex/framework/contract"
+	c "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMemoryRateLimitStore(t *testing.T) {
+	c.Convey("test token bucket", t, func() {
+		now := time.Unix(0, 0)
+		store := NewMemoryRateLimitStore(0)
+		store.now = func() time.Time { return now }
+		take := func() contract.RateLimitResult {
+			result, err := store.Take(context.Background(), "ip", contract.RateLimitTokenBucket, 2, time.Second)
+			c.So(err, c.ShouldBeNil)
+			return result
+		}
+		c.So(take().Remaining, c.ShouldEqual, 1)
+		c.So(take().Allowed, c.ShouldBeTrue)
+		result := take()
+		c.So(result.Allowed, c.ShouldBeFalse)
+		c.So(result.RetryAfter, c.ShouldEqual, 500*time.Millisecond)
+		c.So(result.Reset, c.ShouldEqual, time.Second)
+		now = now.Add(500 * time.Millisecond)
+		c.So(take().Allowed, c.ShouldBeTrue)
+		c.So(take().Allowed, c.ShouldBeFalse)
+	})
+
+	c.Convey("test sliding window", t, func() {
+		now := time.Unix(0, 0)
+		store := NewMemoryRateLimitStore(0)
+		store.now = func() time.Time { return now }
+		take := func() contract.RateLimitResult {
+			result, err := store.Take(context.Background(), "ip", contract.RateLimitSlidingWindow, 4, time.Second)
+			c.So(err, c.ShouldBeNil)
+			return result
+		}
+		for i := 0; i < 4; i++ {
+			c.So(take().Allowed, c.ShouldBeTrue)
+		}
+		result := take()
+		c.So(result.Allowed, c.ShouldBeFalse)
+		c.So(result.RetryAfter, c.ShouldEqual, time.Second)
+		// 下一个窗口过去一半时，上一个窗口的4个请求按一半计算
+		now = now.Add(1500 * time.Millisecond)
+		c.So(take().Allowed, c.ShouldBeTrue)
+		result = take()
+		c.So(result.Allowed, c.ShouldBeTrue)
+		c.So(result.Remaining, c.ShouldEqual, 0)
+		result = take()
+		c.So(result.Allowed, c.ShouldBeFalse)
+		c.So(result.RetryAfter, c.ShouldEqual, 250*time.Millisecond)
+		// 两个窗口之后计数清零
+		now = now.Add(2 * time.Second)
+		c.So(take().Remaining, c.ShouldEqual, 3)
+	})
+
+	c.Convey("test lru eviction", t, func() {
+		store := NewMemoryRateLimitStore(2)
+		for _, key := range []string{"a", "b", "a", "c"} {
+			store.Take(context.Background(), key, contract.RateLimitTokenBucket, 1, time.Minute)
+		}
+		c.So(store.Len(), c.ShouldEqual, 2)
+		// b最久未使用被淘汰，a仍然被限流
+		result, _ := store.Take(context.Background(), "b", contract.RateLimitTokenBucket, 1, time.Minute)
+		c.So(result.Allowed, c.ShouldBeTrue)
+		result, _ = store.Take(context.Background(), "c", contract.RateLimitTokenBucket, 1, time.Minute)
+		c.So(result.Allowed, c.ShouldBeFalse)
+	})
+}
+
+// countingStore 记录调用次数，用于确认容器中的存储被使用
+type countingStore struct {
+	*MemoryRateLimitStore
+	calls int
+}
+
+func (s *countingStore) Take(ctx context.Context, key string, algorithm string, limit int, window time.Duration) (contract.RateLimitResult, error) {
+	s.calls++
+	return s.MemoryRateLimitStore.Take(ctx, key, algorithm, limit, window)
+}
+
+func TestRateLimit(t *testing.T) {
+	c.Convey("test rate limit middleware", t, func() {
+		engine := New()
+		engine.Use(RateLimitWithConfig(RateLimitConfig{
+			Limit:   2,
+			Window:  time.Minute,
+			KeyFunc: RateLimitByHeader("X-API-Key"),
+		}))
+		engine.Get("/", func(ctx *Context) {
+			ctx.String(http.StatusOK, "ok")
+		})
+		request := func(key string) *httptest.ResponseRecorder {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("X-API-Key", key)
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, r)
+			return w
+		}
+		w := request("a")
+		c.So(w.Code, c.ShouldEqual, http.StatusOK)
+		c.So(w.Header().Get("RateLimit-Limit"), c.ShouldEqual, "2")
+		c.So(w.Header().Get("RateLimit-Remaining"), c.ShouldEqual, "1")
+		c.So(w.Header().Get("RateLimit-Reset"), c.ShouldEqual, "30")
+		request("a")
+		w = request("a")
+		c.So(w.Code, c.ShouldEqual, http.StatusTooManyRequests)
+		c.So(w.Header().Get("RateLimit-Remaining"), c.ShouldEqual, "0")
+		c.So(w.Header().Get("Retry-After"), c.ShouldEqual, "30")
+		c.So(request("b").Code, c.ShouldEqual, http.StatusOK)
+	})
+
+	c.Convey("test rate limit store from container", t, func() {
+		engine := New()
+		store := &countingStore{MemoryRateLimitStore: NewMemoryRateLimitStore(0)}
+		c.So(engine.Bind(instanceProvider{name: contract.RateLimitKey, instance: store}), c.ShouldBeNil)
+		engine.Get("/user/:id", RateLimitWithConfig(RateLimitConfig{
+			Limit:     1,
+			Window:    time.Second,
+			Algorithm: contract.RateLimitSlidingWindow,
+			KeyFunc:   RateLimitByRoute,
+		}), func(ctx *Context) {
+			ctx.String(http.StatusOK, "ok")
+		})
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/user/1", nil))
+		c.So(w.Code, c.ShouldEqual, http.StatusOK)
+		w = httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/user/2", nil))
+		c.So(w.Code, c.ShouldEqual, http.StatusTooManyRequests)
+		c.So(store.calls, c.ShouldEqual, 2)
+	})
+}
@@ -1,35 +1,248 @@
 package framework
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
+	"github.com/hiholder/geex/framework/render"
+	"html/template"
 	"log"
+	"net"
 	"net/http"
+	"os"
 	"runtime"
 	"strings"
+	"syscall"
 )
 
-func trace(message string) string {
-	var pcs [32]uintptr
-	n := runtime.Callers(3, pcs[:]) // 跳过三个caller
-	var strBuilder strings.Builder
-	strBuilder.WriteString(message + "\nTraceback:")
-	for _, pc := range pcs[:n] {
-		fn := runtime.FuncForPC(pc)
-		file, line := fn.FileLine(pc)
-		strBuilder.WriteString(fmt.Sprintf("\n\t%s:%d", file, line))
+// RecoveryFunc 处理panic，err为recover的返回值
+type RecoveryFunc func(c *Context, err interface{})
+
+// stackFrame panic调用栈中的一帧
+type stackFrame struct {
+	Function string `json:"function"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+}
+
+func (f stackFrame) String() string {
+	return fmt.Sprintf("%s\n\t%s:%d", f.Function, f.File, f.Line)
+}
+
+// stack 在recover所在的defer函数中调用，返回panic发生处开始的调用栈
+func stack() []stackFrame {
+	var pcs [64]uintptr
+	n := runtime.Callers(2, pcs[:])
+	frames := runtime.CallersFrames(pcs[:n])
+	var (
+		result   []stackFrame
+		panicked bool
+	)
+	for {
+		frame, more := frames.Next()
+		// 跳过defer函数和runtime中处理panic的部分
+		switch {
+		case frame.Function == "runtime.gopanic":
+			panicked = true
+		case panicked && (len(result) > 0 || !strings.HasPrefix(frame.Function, "runtime.")):
+			result = append(result, stackFrame{Function: frame.Function, File: frame.File, Line: frame.Line})
+		}
+		if !more {
+			break
+		}
+	}
+	return result
+}
+
+// stackPanic 把其他goroutine中的panic连同发生时的调用栈传回当前goroutine
+type stackPanic struct {
+	value  interface{}
+	frames []stackFrame
+}
+
+func (p *stackPanic) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%v", p.value)
+	for _, frame := range p.frames {
+		b.WriteString("\n")
+		b.WriteString(frame.String())
 	}
-	return strBuilder.String()
+	return b.String()
 }
 
+// isBrokenPipe 判断是否是客户端断开连接导致的写入错误，这类错误不需要响应也不算服务端故障
+func isBrokenPipe(err interface{}) bool {
+	e, ok := err.(error)
+	if !ok {
+		return false
+	}
+	var opErr *net.OpError
+	if !errors.As(e, &opErr) {
+		return false
+	}
+	if errors.Is(opErr, syscall.EPIPE) || errors.Is(opErr, syscall.ECONNRESET) {
+		return true
+	}
+	msg := strings.ToLower(opErr.Error())
+	return strings.Contains(msg, "broken pipe") || strings.Contains(msg, "connection reset by peer")
+}
+
+// Recovery 捕获后续处理链中的panic并返回500，开发模式下返回带源码的错误页面
 func Recovery() HandlerFunc {
+	return RecoveryWithHandler(defaultRecovery)
+}
+
+// RecoveryWithHandler 捕获后续处理链中的panic，并交给handle写出响应
+// panic的信息和调用栈写入容器中的日志服务，没有绑定日志服务时使用标准库log输出
+// 客户端断开连接或响应头已经写出时不再调用handle
+func RecoveryWithHandler(handle RecoveryFunc) HandlerFunc {
 	return func(c *Context) {
 		defer func() {
-			if err := recover(); err != nil {
-				message := fmt.Sprintf("%s", err)
-				log.Printf("%s\n\n", trace(message))
-				c.Fail(http.StatusInternalServerError, "Internal Server Error")
+			err := recover()
+			if err == nil {
+				return
+			}
+			frames := stack()
+			// 在其他goroutine中发生的panic，使用原始的调用栈
+			if p, ok := err.(*stackPanic); ok {
+				err, frames = p.value, p.frames
 			}
+			// 由net/http中断连接，不记录日志
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+			brokenPipe := isBrokenPipe(err)
+			reportPanic(c, err, frames, brokenPipe)
+			c.Abort()
+			if brokenPipe || c.Writer.Written() {
+				return
+			}
+			c.Set(panicFramesKey, frames)
+			handle(c, err)
 		}()
 		c.Next()
 	}
 }
+
+// panicFramesKey 默认的handle通过该key获取panic的调用栈
+const panicFramesKey = "geex:panic_frames"
+
+func reportPanic(c *Context, err interface{}, frames []stackFrame, brokenPipe bool) {
+	msg := "panic recovered"
+	if brokenPipe {
+		msg = "client disconnected"
+	}
+	logger := logService(c.container)
+	if logger == nil {
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "[geex] %s: %v\n%s %s", msg, err, c.Method, c.Path)
+		for _, frame := range frames {
+			sb.WriteString("\n" + frame.String())
+		}
+		log.Printf("%s\n\n", sb.String())
+		return
+	}
+	fields := map[string]interface{}{
+		"error":  fmt.Sprint(err),
+		"method": c.Method,
+		"path":   c.Path,
+		"route":  c.FullPath(),
+		"stack":  frames,
+	}
+	if brokenPipe {
+		logger.CtxWarn(c, msg, fields)
+		return
+	}
+	logger.CtxError(c, msg, fields)
+}
+
+func defaultRecovery(c *Context, err interface{}) {
+	accept, _ := c.Header("Accept")
+	if c.engine != nil && c.engine.devMode && !strings.Contains(accept, "application/json") {
+		frames, _ := c.MustGet(panicFramesKey).([]stackFrame)
+		c.Render(http.StatusInternalServerError, render.HTML{
+			Template: panicTemplate,
+			Data: panicPage{
+				Error:  fmt.Sprint(err),
+				Method: c.Method,
+				Path:   c.Path,
+				Frames: sourceFrames(frames),
+			},
+		})
+		return
+	}
+	c.Fail(http.StatusInternalServerError, "Internal Server Error")
+}
+
+// 错误页面中每一帧显示的源码行数为前后各sourceContext行
+const sourceContext = 3
+
+type panicPage struct {
+	Error  string
+	Method string
+	Path   string
+	Frames []panicFrame
+}
+
+type panicFrame struct {
+	stackFrame
+	Lines []sourceLine
+}
+
+type sourceLine struct {
+	Number  int
+	Code    string
+	Current bool
+}
+
+// sourceFrames 读取每一帧前后的源码，文件无法读取时只显示位置
+func sourceFrames(frames []stackFrame) []panicFrame {
+	result := make([]panicFrame, 0, len(frames))
+	for _, frame := range frames {
+		result = append(result, panicFrame{stackFrame: frame, Lines: sourceLines(frame.File, frame.Line)})
+	}
+	return result
+}
+
+func sourceLines(file string, line int) []sourceLine {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var lines []sourceLine
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan() && n <= line+sourceContext; n++ {
+		if n >= line-sourceContext {
+			lines = append(lines, sourceLine{Number: n, Code: scanner.Text(), Current: n == line})
+		}
+	}
+	return lines
+}
+
+var panicTemplate = template.Must(template.New("panic").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>500 Internal Server Error</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+h1 { color: #c00; }
+.frame { margin-bottom: 1.5em; }
+.func { font-weight: bold; }
+pre { background: #f6f6f6; padding: 0.5em; margin: 0.3em 0; }
+.current { background: #fdd; display: block; }
+</style>
+</head>
+<body>
+<h1>panic: {{.Error}}</h1>
+<p>{{.Method}} {{.Path}}</p>
+{{range .Frames}}<div class="frame">
+<div class="func">{{.Function}}</div>
+<div>{{.File}}:{{.Line}}</div>
+{{if .Lines}}<pre>{{range .Lines}}<span{{if .Current}} class="current"{{end}}>{{printf "%5d" .Number}}  {{.Code}}</span>
+{{end}}</pre>{{end}}
+</div>
+{{end}}</body>
+</html>
+`))
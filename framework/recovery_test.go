@@ -0,0 +1,117 @@
+package framework
+
+import (
+	"github.com/hiholder/geex/framework/contract"
+	c "github.com/smartystreets/goconvey/convey"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRecovery(t *testing.T) {
+	c.Convey("test recovery", t, func() {
+		engine := New()
+		logger := &recordLog{}
+		c.So(engine.Bind(instanceProvider{name: contract.LogKey, instance: logger}), c.ShouldBeNil)
+		var handled []interface{}
+		engine.Use(RecoveryWithHandler(func(ctx *Context, err interface{}) {
+			handled = append(handled, err)
+			ctx.String(http.StatusInternalServerError, "recovered")
+		}))
+		engine.Get("/panic", func(ctx *Context) {
+			panic("boom")
+		})
+		engine.Get("/written", func(ctx *Context) {
+			ctx.String(http.StatusOK, "partial")
+			panic("late")
+		})
+		engine.Get("/pipe", func(ctx *Context) {
+			panic(&net.OpError{Op: "write", Net: "tcp", Err: &os.SyscallError{Syscall: "write", Err: syscall.EPIPE}})
+		})
+
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+		c.So(w.Code, c.ShouldEqual, http.StatusInternalServerError)
+		c.So(w.Body.String(), c.ShouldEqual, "recovered")
+		c.So(handled, c.ShouldResemble, []interface{}{"boom"})
+		c.So(logger.entries, c.ShouldHaveLength, 1)
+		c.So(logger.entries[0].level, c.ShouldEqual, contract.ErrorLevel)
+		c.So(logger.entries[0].fields["error"], c.ShouldEqual, "boom")
+		frames := logger.entries[0].fields["stack"].([]stackFrame)
+		c.So(frames[0].Function, c.ShouldContainSubstring, "TestRecovery")
+		c.So(frames[0].File, c.ShouldEndWith, "recovery_test.go")
+
+		// 响应已经写出时不再调用handler
+		w = httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/written", nil))
+		c.So(w.Code, c.ShouldEqual, http.StatusOK)
+		c.So(w.Body.String(), c.ShouldEqual, "partial")
+		c.So(handled, c.ShouldHaveLength, 1)
+
+		// 客户端断开连接只记录Warn日志
+		w = httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/pipe", nil))
+		c.So(handled, c.ShouldHaveLength, 1)
+		c.So(logger.entries, c.ShouldHaveLength, 3)
+		c.So(logger.entries[2].level, c.ShouldEqual, contract.WarnLevel)
+		c.So(logger.entries[2].msg, c.ShouldEqual, "client disconnected")
+	})
+
+	c.Convey("test default recovery", t, func() {
+		engine := New()
+		engine.Use(Recovery())
+		engine.Get("/panic", func(ctx *Context) {
+			panic("boom")
+		})
+
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+		c.So(w.Code, c.ShouldEqual, http.StatusInternalServerError)
+		c.So(w.Body.String(), c.ShouldContainSubstring, "Internal Server Error")
+
+		// debug模式只打印路由表，不暴露源码
+		engine.SetDebug(true)
+		w = httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+		c.So(w.Body.String(), c.ShouldNotContainSubstring, "recovery_test.go")
+
+		// 开发模式下返回带源码的错误页面
+		engine.SetDevMode(true)
+		w = httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+		c.So(w.Code, c.ShouldEqual, http.StatusInternalServerError)
+		c.So(w.Header().Get("Content-Type"), c.ShouldStartWith, "text/html")
+		body := w.Body.String()
+		c.So(body, c.ShouldContainSubstring, "panic: boom")
+		c.So(body, c.ShouldContainSubstring, "recovery_test.go")
+		c.So(strings.Contains(body, `class="current"`), c.ShouldBeTrue)
+		c.So(body, c.ShouldContainSubstring, "panic(&#34;boom&#34;)")
+	})
+
+	c.Convey("test panic stack through timeout", t, func() {
+		engine := New()
+		logger := &recordLog{}
+		c.So(engine.Bind(instanceProvider{name: contract.LogKey, instance: logger}), c.ShouldBeNil)
+		var handled interface{}
+		engine.Use(RecoveryWithHandler(func(ctx *Context, err interface{}) {
+			handled = err
+			ctx.Status(http.StatusInternalServerError)
+		}), Timeout(time.Second, nil))
+		engine.Get("/panic", func(ctx *Context) {
+			panic("boom")
+		})
+
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+		c.So(w.Code, c.ShouldEqual, http.StatusInternalServerError)
+		c.So(handled, c.ShouldEqual, "boom")
+		frames := logger.entries[0].fields["stack"].([]stackFrame)
+		c.So(frames[0].Function, c.ShouldContainSubstring, "TestRecovery")
+		c.So(frames[0].File, c.ShouldEndWith, "recovery_test.go")
+	})
+}
@@ -0,0 +1,21 @@
+package render
+
+import (
+	gerrors "github.com/pkg/errors"
+	"io"
+)
+
+// Data 原始字节，ContentType为空时由net/http根据内容判断
+type Data struct {
+	Type string
+	Data []byte
+}
+
+func (r Data) Render(w io.Writer) error {
+	_, err := w.Write(r.Data)
+	return gerrors.WithStack(err)
+}
+
+func (r Data) ContentType() string {
+	return r.Type
+}
@@ -0,0 +1,28 @@
+package render
+
+import (
+	gerrors "github.com/pkg/errors"
+	"html/template"
+	"io"
+)
+
+// HTML 使用html/template渲染，Name为空时执行Template本身
+type HTML struct {
+	Template *template.Template
+	Name     string
+	Data     interface{}
+}
+
+func (r HTML) Render(w io.Writer) error {
+	if r.Template == nil {
+		return gerrors.New("html template not loaded")
+	}
+	if r.Name == "" {
+		return gerrors.WithStack(r.Template.Execute(w, r.Data))
+	}
+	return gerrors.WithStack(r.Template.ExecuteTemplate(w, r.Name, r.Data))
+}
+
+func (r HTML) ContentType() string {
+	return "text/html; charset=utf-8"
+}
@@ -0,0 +1,113 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	gerrors "github.com/pkg/errors"
+	"io"
+	"regexp"
+)
+
+const (
+	jsonContentType       = "application/json; charset=utf-8"
+	javascriptContentType = "application/javascript; charset=utf-8"
+	// defaultSecurePrefix SecureJSON默认的前缀，防止JSON数组被当作脚本劫持
+	defaultSecurePrefix = "while(1);"
+)
+
+// JSONP回调函数名只允许合法的js标识符，避免注入
+var callbackPattern = regexp.MustCompile(`^[a-zA-Z_$][a-zA-Z0-9_$.]*$`)
+
+// JSON 普通JSON
+type JSON struct {
+	Data interface{}
+}
+
+func (r JSON) Render(w io.Writer) error {
+	return gerrors.WithStack(json.NewEncoder(w).Encode(r.Data))
+}
+
+func (r JSON) ContentType() string {
+	return jsonContentType
+}
+
+// IndentedJSON 带缩进的JSON，便于阅读
+type IndentedJSON struct {
+	Data interface{}
+}
+
+func (r IndentedJSON) Render(w io.Writer) error {
+	bs, err := json.MarshalIndent(r.Data, "", "    ")
+	if err != nil {
+		return gerrors.WithStack(err)
+	}
+	_, err = w.Write(bs)
+	return gerrors.WithStack(err)
+}
+
+func (r IndentedJSON) ContentType() string {
+	return jsonContentType
+}
+
+// SecureJSON 数据为JSON数组时在前面加上Prefix，Prefix为空时使用"while(1);"
+type SecureJSON struct {
+	Prefix string
+	Data   interface{}
+}
+
+func (r SecureJSON) Render(w io.Writer) error {
+	bs, err := json.Marshal(r.Data)
+	if err != nil {
+		return gerrors.WithStack(err)
+	}
+	if bytes.HasPrefix(bs, []byte("[")) && bytes.HasSuffix(bs, []byte("]")) {
+		prefix := r.Prefix
+		if prefix == "" {
+			prefix = defaultSecurePrefix
+		}
+		if _, err = io.WriteString(w, prefix); err != nil {
+			return gerrors.WithStack(err)
+		}
+	}
+	_, err = w.Write(bs)
+	return gerrors.WithStack(err)
+}
+
+func (r SecureJSON) ContentType() string {
+	return jsonContentType
+}
+
+// JSONP 以callback(data);的形式输出，Callback为空时等同于JSON
+type JSONP struct {
+	Callback string
+	Data     interface{}
+}
+
+func (r JSONP) Render(w io.Writer) error {
+	bs, err := json.Marshal(r.Data)
+	if err != nil {
+		return gerrors.WithStack(err)
+	}
+	if r.Callback == "" {
+		_, err = w.Write(bs)
+		return gerrors.WithStack(err)
+	}
+	if !callbackPattern.MatchString(r.Callback) {
+		return gerrors.Errorf("invalid jsonp callback %q", r.Callback)
+	}
+	_, err = io.WriteString(w, r.Callback+"(")
+	if err == nil {
+		_, err = w.Write(bs)
+	}
+	if err == nil {
+		_, err = io.WriteString(w, ");")
+	}
+	return gerrors.WithStack(err)
+}
+
+func (r JSONP) ContentType() string {
+	if r.Callback == "" {
+		return jsonContentType
+	}
+	return javascriptContentType
+}
@@ -0,0 +1,23 @@
+package render
+
+import "io"
+
+// Render 响应渲染器，Context在写入状态码前设置ContentType，再调用Render写入响应体
+type Render interface {
+	// Render 将数据写入w
+	Render(w io.Writer) error
+	// ContentType 响应的Content-Type，为空时不设置
+	ContentType() string
+}
+
+var (
+	_ Render = JSON{}
+	_ Render = IndentedJSON{}
+	_ Render = SecureJSON{}
+	_ Render = JSONP{}
+	_ Render = XML{}
+	_ Render = YAML{}
+	_ Render = Text{}
+	_ Render = HTML{}
+	_ Render = Data{}
+)
@@ -0,0 +1,27 @@
+package render
+
+import (
+	"fmt"
+	gerrors "github.com/pkg/errors"
+	"io"
+)
+
+// Text 纯文本，Data不为空时按Format格式化
+type Text struct {
+	Format string
+	Data   []interface{}
+}
+
+func (r Text) Render(w io.Writer) error {
+	var err error
+	if len(r.Data) > 0 {
+		_, err = fmt.Fprintf(w, r.Format, r.Data...)
+	} else {
+		_, err = io.WriteString(w, r.Format)
+	}
+	return gerrors.WithStack(err)
+}
+
+func (r Text) ContentType() string {
+	return "text/plain; charset=utf-8"
+}
@@ -0,0 +1,20 @@
+package render
+
+import (
+	"encoding/xml"
+	gerrors "github.com/pkg/errors"
+	"io"
+)
+
+// XML 使用encoding/xml编码
+type XML struct {
+	Data interface{}
+}
+
+func (r XML) Render(w io.Writer) error {
+	return gerrors.WithStack(xml.NewEncoder(w).Encode(r.Data))
+}
+
+func (r XML) ContentType() string {
+	return "application/xml; charset=utf-8"
+}
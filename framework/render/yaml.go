@@ -0,0 +1,25 @@
+package render
+
+import (
+	gerrors "github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+	"io"
+)
+
+// YAML 使用yaml.v3编码
+type YAML struct {
+	Data interface{}
+}
+
+func (r YAML) Render(w io.Writer) error {
+	bs, err := yaml.Marshal(r.Data)
+	if err != nil {
+		return gerrors.WithStack(err)
+	}
+	_, err = w.Write(bs)
+	return gerrors.WithStack(err)
+}
+
+func (r YAML) ContentType() string {
+	return "application/x-yaml; charset=utf-8"
+}
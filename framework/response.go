@@ -0,0 +1,139 @@
+package framework
+
+import (
+	"bytes"
+	"github.com/hiholder/geex/framework/render"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 渲染时使用的缓冲区，先完整渲染再写入响应，渲染失败时还可以返回500
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// maxPooledBuffer 超过该大小的缓冲区不放回池中，避免长期占用内存
+const maxPooledBuffer = 64 << 10
+
+// Render 所有响应的统一出口: 设置Content-Type，写入状态码，再写入渲染好的响应体
+// 渲染失败时返回500，超时后不再写入
+func (c *Context) Render(code int, r render.Render) {
+	c.writerMux.Lock()
+	defer c.writerMux.Unlock()
+	if c.hasTimeout {
+		return
+	}
+	if !bodyAllowedForStatus(code) {
+		c.status(code)
+		c.Writer.WriteHeaderNow()
+		return
+	}
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer func() {
+		if buf.Cap() <= maxPooledBuffer {
+			bufferPool.Put(buf)
+		}
+	}()
+	if err := r.Render(buf); err != nil {
+		c.StatusCode = http.StatusInternalServerError
+		http.Error(c.Writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if ct := r.ContentType(); ct != "" && c.Writer.Header().Get("Content-Type") == "" {
+		c.Writer.Header().Set("Content-Type", ct)
+	}
+	c.status(code)
+	c.Writer.Write(buf.Bytes())
+}
+
+// bodyAllowedForStatus 1xx、204和304响应不允许有响应体
+func bodyAllowedForStatus(code int) bool {
+	switch {
+	case code >= 100 && code <= 199:
+		return false
+	case code == http.StatusNoContent, code == http.StatusNotModified:
+		return false
+	}
+	return true
+}
+
+// Negotiate 根据Accept请求头从offers中选择渲染器，offers按优先级排列
+// 没有Accept请求头时使用第一个，没有可接受的类型时返回406
+func (c *Context) Negotiate(code int, offers ...render.Render) {
+	if len(offers) == 0 {
+		c.Fail(http.StatusNotAcceptable, "no offers for content negotiation")
+		return
+	}
+	accept, _ := c.Header("Accept")
+	for _, mediaType := range parseAccept(accept) {
+		for _, offer := range offers {
+			if matchMediaType(mediaType, offer.ContentType()) {
+				c.Render(code, offer)
+				return
+			}
+		}
+	}
+	if strings.TrimSpace(accept) == "" {
+		c.Render(code, offers[0])
+		return
+	}
+	c.Abort()
+	c.String(http.StatusNotAcceptable, "%s\n", http.StatusText(http.StatusNotAcceptable))
+}
+
+// parseAccept 解析Accept请求头，按q值从高到低返回媒体类型，q=0的类型被忽略
+func parseAccept(accept string) []string {
+	type acceptItem struct {
+		mediaType string
+		q         float64
+	}
+	var items []acceptItem
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(fields[0]))
+		if mediaType == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q > 0 {
+			items = append(items, acceptItem{mediaType: mediaType, q: q})
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].q > items[j].q
+	})
+	mediaTypes := make([]string, 0, len(items))
+	for _, item := range items {
+		mediaTypes = append(mediaTypes, item.mediaType)
+	}
+	return mediaTypes
+}
+
+// matchMediaType 判断Accept中的类型是否可以接受contentType，支持"*/*"和"type/*"
+func matchMediaType(accept, contentType string) bool {
+	if i := strings.IndexByte(contentType, ';'); i >= 0 {
+		contentType = contentType[:i]
+	}
+	contentType = strings.ToLower(strings.TrimSpace(contentType))
+	if accept == "*/*" || accept == contentType {
+		return true
+	}
+	if strings.HasSuffix(accept, "/*") {
+		return strings.HasPrefix(contentType, accept[:len(accept)-1])
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package framework
+
+import (
+	"github.com/hiholder/geex/framework/render"
+	c "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type renderItem struct {
+	A int `json:"a" xml:"a" yaml:"a"`
+}
+
+func TestRender(t *testing.T) {
+	c.Convey("test built-in renderers", t, func() {
+		cases := []struct {
+			handler     HandlerFunc
+			contentType string
+			body        string
+		}{
+			{func(ctx *Context) { ctx.String(http.StatusOK, "hi %s", "geex") }, "text/plain; charset=utf-8", "hi geex"},
+			{func(ctx *Context) { ctx.JSON(http.StatusOK, H{"a": 1}) }, "application/json; charset=utf-8", "{\"a\":1}\n"},
+			{func(ctx *Context) { ctx.SecureJSON(http.StatusOK, []int{1}) }, "application/json; charset=utf-8", "while(1);[1]"},
+			{func(ctx *Context) { ctx.JSONP(http.StatusOK, H{"a": 1}) }, "application/javascript; charset=utf-8", "cb({\"a\":1});"},
+			{func(ctx *Context) { ctx.YAML(http.StatusOK, H{"a": 1}) }, "application/x-yaml; charset=utf-8", "a: 1\n"},
+			{func(ctx *Context) { ctx.Xml(http.StatusOK, renderItem{A: 1}) }, "application/xml; charset=utf-8", "<renderItem><a>1</a></renderItem>"},
+			{func(ctx *Context) { ctx.Data(http.StatusOK, []byte("raw")) }, "", "raw"},
+		}
+		for _, tc := range cases {
+			w := httptest.NewRecorder()
+			ctx := newContext(w, httptest.NewRequest(http.MethodGet, "/?callback=cb", nil))
+			tc.handler(ctx)
+			c.So(w.Code, c.ShouldEqual, http.StatusOK)
+			c.So(w.Header().Get("Content-Type"), c.ShouldEqual, tc.contentType)
+			c.So(w.Body.String(), c.ShouldEqual, tc.body)
+		}
+	})
+
+	c.Convey("test render error and no content", t, func() {
+		w := httptest.NewRecorder()
+		ctx := newContext(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		ctx.JSON(http.StatusOK, H{"ch": make(chan int)})
+		c.So(w.Code, c.ShouldEqual, http.StatusInternalServerError)
+
+		w = httptest.NewRecorder()
+		ctx = newContext(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		ctx.JSON(http.StatusNoContent, H{"a": 1})
+		c.So(w.Code, c.ShouldEqual, http.StatusNoContent)
+		c.So(w.Body.Len(), c.ShouldEqual, 0)
+	})
+
+	c.Convey("test content negotiation", t, func() {
+		negotiate := func(accept string) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if accept != "" {
+				r.Header.Set("Accept", accept)
+			}
+			data := renderItem{A: 1}
+			newContext(w, r).Negotiate(http.StatusOK, render.JSON{Data: data}, render.XML{Data: data}, render.YAML{Data: data})
+			return w
+		}
+		c.So(negotiate("").Header().Get("Content-Type"), c.ShouldStartWith, "application/json")
+		c.So(negotiate("text/xml;q=0.5, application/xml").Header().Get("Content-Type"), c.ShouldStartWith, "application/xml")
+		c.So(negotiate("application/xml;q=0.2, application/x-yaml;q=0.8").Header().Get("Content-Type"), c.ShouldStartWith, "application/x-yaml")
+		c.So(negotiate("application/*").Header().Get("Content-Type"), c.ShouldStartWith, "application/json")
+		c.So(negotiate("text/html").Code, c.ShouldEqual, http.StatusNotAcceptable)
+	})
+}
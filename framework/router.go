@@ -15,17 +15,50 @@ var (
 )
 
 type IGroup interface {
-	Get(string, HandlerFunc) IGroup
-	Post(string, HandlerFunc) IGroup
-	Delete(string, HandlerFunc) IGroup
-	Patch(string, HandlerFunc) IGroup
-	Put(string, HandlerFunc) IGroup
-	Options(string, HandlerFunc) IGroup
-	Head(string, HandlerFunc) IGroup
+	Get(string, ...HandlerFunc) IRoute
+	Post(string, ...HandlerFunc) IRoute
+	Delete(string, ...HandlerFunc) IRoute
+	Patch(string, ...HandlerFunc) IRoute
+	Put(string, ...HandlerFunc) IRoute
+	Options(string, ...HandlerFunc) IRoute
+	Head(string, ...HandlerFunc) IRoute
 	Group(string) IGroup
 	Use(...HandlerFunc)
 }
 
+// IRoute 注册路由后返回的路由句柄，可以为路由命名，也可以继续在所属分组上注册路由
+type IRoute interface {
+	IGroup
+	// Name 为路由命名，用于反向生成URL
+	Name(string) IRoute
+	// Err 路由注册或命名过程中的错误
+	Err() error
+}
+
+// Route 已注册的路由
+type Route struct {
+	*RouterGroup
+	method   string
+	pattern  string
+	name     string
+	handlers []HandlerFunc
+	err      error
+}
+
+func (rt *Route) Name(name string) IRoute {
+	if err := rt.engine.nameRoute(name, rt); err != nil {
+		rt.err = err
+		rt.engine.routeError(err)
+		return rt
+	}
+	rt.name = name
+	return rt
+}
+
+func (rt *Route) Err() error {
+	return rt.err
+}
+
 type Router struct {
 	roots    map[string]*node
 	Handlers map[string]HandlerFunc
@@ -7,11 +7,12 @@ import (
 
 func init() {
 	e = New()
-	e.addRouter("GET", "/", nil)
-	e.addRouter("GET", "/hello/:name", nil)
-	e.addRouter("GET", "/hello/b/c", nil)
-	e.addRouter("GET", "/hi/:name", nil)
-	e.addRouter("GET", "/assets/*filepath", nil)
+	handlers := []HandlerFunc{func(c *Context) {}}
+	e.addRouter("GET", "/", handlers)
+	e.addRouter("GET", "/hello/:name", handlers)
+	e.addRouter("GET", "/hello/b/c", handlers)
+	e.addRouter("GET", "/hi/:name", handlers)
+	e.addRouter("GET", "/assets/*filepath", handlers)
 }
 
 func TestParsePattern(t *testing.T) {
@@ -24,8 +25,8 @@ func TestParsePattern(t *testing.T) {
 
 func TestGetRoute(t *testing.T) {
 	c.Convey("Test Get Route", t, func() {
-		handler, ps := e.methodTree["GET"].SearchRouter("/hello/geektutu")
-		c.So(handler, c.ShouldNotBeNil)
+		handlers, ps := e.methodTree["GET"].SearchRouter("/hello/geektutu")
+		c.So(handlers, c.ShouldNotBeEmpty)
 		c.So(ps["name"], c.ShouldEqual, "geektutu")
 	})
 }
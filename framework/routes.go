@@ -0,0 +1,51 @@
+package framework
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"runtime"
+	"text/tabwriter"
+)
+
+// RouteInfo 路由的描述信息
+type RouteInfo struct {
+	Method      string // 请求方法
+	Path        string // 完整的路由，包含分组前缀
+	Name        string // 路由名，未命名时为空
+	Handler     string // 最终处理函数的函数名
+	Middlewares int    // 作用于该路由的中间件个数，包括分组中间件和路由级中间件
+	Group       string // 所属分组的前缀
+}
+
+// Routes 按注册顺序返回所有注册成功的路由
+func (e *Engine) Routes() []RouteInfo {
+	routes := make([]RouteInfo, 0, len(e.routes))
+	for _, route := range e.routes {
+		handlers := route.handlers
+		routes = append(routes, RouteInfo{
+			Method:      route.method,
+			Path:        route.pattern,
+			Name:        route.name,
+			Handler:     nameOfFunction(handlers[len(handlers)-1]),
+			Middlewares: len(e.groupMiddlewares(route.pattern)) + len(handlers) - 1,
+			Group:       route.prefix,
+		})
+	}
+	return routes
+}
+
+// PrintRoutes 以表格形式输出路由
+func (e *Engine) PrintRoutes(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "METHOD\tPATH\tNAME\tHANDLER\tMIDDLEWARES\tGROUP")
+	for _, route := range e.Routes() {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\n", route.Method, route.Path, route.Name, route.Handler, route.Middlewares, route.Group)
+	}
+	tw.Flush()
+}
+
+// nameOfFunction 通过反射获取函数名
+func nameOfFunction(f interface{}) string {
+	return runtime.FuncForPC(reflect.ValueOf(f).Pointer()).Name()
+}
@@ -0,0 +1,51 @@
+package framework
+
+import (
+	"bytes"
+	c "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func routesTestHandler(ctx *Context) {}
+
+func TestRoutes(t *testing.T) {
+	c.Convey("test route introspection", t, func() {
+		engine := New()
+		engine.Use(func(ctx *Context) {})
+		engine.Get("/", routesTestHandler)
+		v1 := engine.Group("/v1")
+		v1.Use(func(ctx *Context) {})
+		v1.Post("/user/:id", func(ctx *Context) {}, routesTestHandler).Name("user.update")
+		route := v1.Post("/user/:name", routesTestHandler)
+		c.So(route.Err(), c.ShouldNotBeNil)
+
+		routes := engine.Routes()
+		c.So(routes, c.ShouldHaveLength, 2)
+		c.So(routes[0], c.ShouldResemble, RouteInfo{
+			Method:      "GET",
+			Path:        "/",
+			Handler:     "github.com/hiholder/geex/framework.routesTestHandler",
+			Middlewares: 1,
+		})
+		c.So(routes[1], c.ShouldResemble, RouteInfo{
+			Method:      "POST",
+			Path:        "/v1/user/:id",
+			Name:        "user.update",
+			Handler:     "github.com/hiholder/geex/framework.routesTestHandler",
+			Middlewares: 3,
+			Group:       "/v1",
+		})
+
+		var buf bytes.Buffer
+		engine.PrintRoutes(&buf)
+		c.So(buf.String(), c.ShouldContainSubstring, "/v1/user/:id")
+	})
+
+	c.Convey("test strict mode", t, func() {
+		engine := New()
+		engine.SetStrict(true)
+		engine.Get("/user/:id", routesTestHandler)
+		c.So(func() { engine.Get("/user/:name", routesTestHandler) }, c.ShouldPanic)
+		c.So(func() { engine.Get("/", routesTestHandler).Name("") }, c.ShouldPanic)
+	})
+}
@@ -0,0 +1,280 @@
+package framework
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"github.com/hiholder/geex/framework/contract"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// CSP中常用的来源
+const (
+	CSPSelf          = "'self'"
+	CSPNone          = "'none'"
+	CSPUnsafeInline  = "'unsafe-inline'"
+	CSPUnsafeEval    = "'unsafe-eval'"
+	CSPStrictDynamic = "'strict-dynamic'"
+	// CSPNonce 占位符，每个请求替换为'nonce-<随机值>'
+	CSPNonce = "{nonce}"
+)
+
+// secureDisabled 取值为"-"的响应头不输出
+const secureDisabled = "-"
+
+type cspNonceKey struct{}
+
+// CSP Content-Security-Policy的构造器
+type CSP struct {
+	directives []string
+	sources    map[string][]string
+}
+
+func NewCSP() *CSP {
+	return &CSP{sources: make(map[string][]string)}
+}
+
+// Add 为指令添加来源，重复添加同一指令时合并来源
+func (p *CSP) Add(directive string, sources ...string) *CSP {
+	if _, ok := p.sources[directive]; !ok {
+		p.directives = append(p.directives, directive)
+	}
+	p.sources[directive] = append(p.sources[directive], sources...)
+	return p
+}
+
+// String 按添加的顺序输出策略，需要nonce的指令包含CSPNonce占位符
+func (p *CSP) String() string {
+	parts := make([]string, 0, len(p.directives))
+	for _, directive := range p.directives {
+		parts = append(parts, strings.TrimSpace(directive+" "+strings.Join(p.sources[directive], " ")))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// SecureConfig 安全响应头中间件的配置
+// 为零值的字段从配置服务的secure.*中读取，再使用默认值，响应头取值为"-"时不输出
+type SecureConfig struct {
+	// 允许的Host，为空时不检查，Host不在其中时返回400
+	AllowedHosts []string
+	// HTTP请求重定向到HTTPS
+	SSLRedirect bool
+	// 重定向时使用的Host，为空时使用请求的Host
+	SSLHost string
+	// 使用临时重定向，默认为永久重定向
+	SSLTemporaryRedirect bool
+	// 反向代理终止TLS时表示原始请求为HTTPS的其他请求头，例如X-Forwarded-Ssl: on
+	// 与X-Forwarded-Proto和Forwarded相同，只信任Engine.SetTrustedProxies中的代理发送的请求头
+	SSLProxyHeaders map[string]string
+
+	// Strict-Transport-Security的max-age，为0时不输出，只在HTTPS请求中输出
+	STSSeconds           int64
+	STSIncludeSubdomains bool
+	STSPreload           bool
+
+	ContentTypeNosniff string // 默认为"nosniff"
+	FrameOptions       string // 默认为"DENY"
+	ReferrerPolicy     string // 默认为"strict-origin-when-cross-origin"
+	PermissionsPolicy  string // 例如"camera=(), microphone=()"，默认不输出
+	// Content-Security-Policy，可以用NewCSP构造，包含CSPNonce时为每个请求生成nonce
+	ContentSecurityPolicy string
+	// 只报告不拦截，输出Content-Security-Policy-Report-Only
+	CSPReportOnly bool
+}
+
+// Secure 使用默认配置输出安全响应头
+func Secure() HandlerFunc {
+	return SecureWithConfig(SecureConfig{})
+}
+
+// SecureWithConfig 检查Host、重定向到HTTPS并输出安全响应头
+// 使用nonce时模板中用{{ cspNonce }}输出，例如<script nonce="{{ cspNonce }}">
+func SecureWithConfig(conf SecureConfig) HandlerFunc {
+	var once sync.Once
+	var sts string
+	return func(c *Context) {
+		once.Do(func() {
+			conf = loadSecureConfig(c.container, conf)
+			sts = conf.stsHeader()
+		})
+		if len(conf.AllowedHosts) > 0 && !conf.allowedHost(c.Host()) {
+			c.Abort()
+			errorResponse(c, http.StatusBadRequest, "400 BAD REQUEST: host not allowed")
+			return
+		}
+		https := conf.isHTTPS(c)
+		if conf.SSLRedirect && !https {
+			conf.redirectSSL(c)
+			return
+		}
+
+		header := c.Writer.Header()
+		if sts != "" && https {
+			header.Set("Strict-Transport-Security", sts)
+		}
+		setSecureHeader(header, "X-Content-Type-Options", conf.ContentTypeNosniff)
+		setSecureHeader(header, "X-Frame-Options", conf.FrameOptions)
+		setSecureHeader(header, "Referrer-Policy", conf.ReferrerPolicy)
+		setSecureHeader(header, "Permissions-Policy", conf.PermissionsPolicy)
+		if policy := conf.ContentSecurityPolicy; policy != "" && policy != secureDisabled {
+			if strings.Contains(policy, CSPNonce) {
+				nonce := newCSPNonce()
+				policy = strings.ReplaceAll(policy, CSPNonce, "'nonce-"+nonce+"'")
+				c.Req = c.Req.WithContext(context.WithValue(c.Req.Context(), cspNonceKey{}, nonce))
+				c.setHTMLFunc("cspNonce", func() string {
+					return nonce
+				})
+			}
+			name := "Content-Security-Policy"
+			if conf.CSPReportOnly {
+				name = "Content-Security-Policy-Report-Only"
+			}
+			header.Set(name, policy)
+		}
+		c.Next()
+	}
+}
+
+func setSecureHeader(header http.Header, key, value string) {
+	if value != "" && value != secureDisabled {
+		header.Set(key, value)
+	}
+}
+
+func (conf *SecureConfig) stsHeader() string {
+	if conf.STSSeconds <= 0 {
+		return ""
+	}
+	sts := "max-age=" + strconv.FormatInt(conf.STSSeconds, 10)
+	if conf.STSIncludeSubdomains {
+		sts += "; includeSubDomains"
+	}
+	if conf.STSPreload {
+		sts += "; preload"
+	}
+	return sts
+}
+
+// allowedHost 配置中带端口时完整比较，否则忽略请求Host中的端口
+func (conf *SecureConfig) allowedHost(host string) bool {
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = h
+	}
+	for _, allowed := range conf.AllowedHosts {
+		if strings.EqualFold(allowed, host) || strings.EqualFold(allowed, hostname) {
+			return true
+		}
+	}
+	return false
+}
+
+func (conf *SecureConfig) isHTTPS(c *Context) bool {
+	if c.Scheme() == "https" {
+		return true
+	}
+	// 其他来源可以随意设置这些请求头
+	if !c.fromTrustedProxy() {
+		return false
+	}
+	for key, value := range conf.SSLProxyHeaders {
+		if strings.EqualFold(c.Req.Header.Get(key), value) {
+			return true
+		}
+	}
+	return false
+}
+
+// redirectSSL GET和HEAD使用301/302，其他方法使用308/307保留请求方法和请求体
+func (conf *SecureConfig) redirectSSL(c *Context) {
+	host := conf.SSLHost
+	if host == "" {
+		host = c.Host()
+	}
+	safe := c.Method == http.MethodGet || c.Method == http.MethodHead
+	code := http.StatusPermanentRedirect
+	switch {
+	case conf.SSLTemporaryRedirect && safe:
+		code = http.StatusFound
+	case conf.SSLTemporaryRedirect:
+		code = http.StatusTemporaryRedirect
+	case safe:
+		code = http.StatusMovedPermanently
+	}
+	c.SetHeader("Location", "https://"+host+c.Req.URL.RequestURI())
+	c.AbortWithStatus(code)
+}
+
+func newCSPNonce() string {
+	b := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// CSPNonce 当前请求CSP中的nonce，没有使用nonce时为空
+func (c *Context) CSPNonce() string {
+	if c.Req == nil {
+		return ""
+	}
+	nonce, _ := c.Req.Context().Value(cspNonceKey{}).(string)
+	return nonce
+}
+
+// noCSPNonce 没有使用nonce时模板中的cspNonce输出为空
+func noCSPNonce() string {
+	return ""
+}
+
+func loadSecureConfig(container Container, conf SecureConfig) SecureConfig {
+	if container != nil && container.IsBind(contract.ConfigKey) {
+		if config, ok := container.MustMake(contract.ConfigKey).(contract.Config); ok {
+			if conf.AllowedHosts == nil && config.IsExist("secure.allowed_hosts") {
+				conf.AllowedHosts = config.GetStringSlice("secure.allowed_hosts")
+			}
+			boolean := func(value *bool, key string) {
+				if !*value && config.IsExist(key) {
+					*value = config.GetBool(key)
+				}
+			}
+			boolean(&conf.SSLRedirect, "secure.ssl_redirect")
+			boolean(&conf.SSLTemporaryRedirect, "secure.ssl_temporary_redirect")
+			boolean(&conf.STSIncludeSubdomains, "secure.sts_include_subdomains")
+			boolean(&conf.STSPreload, "secure.sts_preload")
+			boolean(&conf.CSPReportOnly, "secure.csp_report_only")
+			str := func(value *string, key string) {
+				if *value == "" && config.IsExist(key) {
+					*value = config.GetString(key)
+				}
+			}
+			str(&conf.SSLHost, "secure.ssl_host")
+			str(&conf.ContentTypeNosniff, "secure.content_type_nosniff")
+			str(&conf.FrameOptions, "secure.frame_options")
+			str(&conf.ReferrerPolicy, "secure.referrer_policy")
+			str(&conf.PermissionsPolicy, "secure.permissions_policy")
+			str(&conf.ContentSecurityPolicy, "secure.content_security_policy")
+			if conf.SSLProxyHeaders == nil && config.IsExist("secure.ssl_proxy_headers") {
+				conf.SSLProxyHeaders = config.GetStringMapString("secure.ssl_proxy_headers")
+			}
+			if conf.STSSeconds == 0 && config.IsExist("secure.sts_seconds") {
+				conf.STSSeconds = int64(config.GetInt("secure.sts_seconds"))
+			}
+		}
+	}
+	if conf.ContentTypeNosniff == "" {
+		conf.ContentTypeNosniff = "nosniff"
+	}
+	if conf.FrameOptions == "" {
+		conf.FrameOptions = "DENY"
+	}
+	if conf.ReferrerPolicy == "" {
+		conf.ReferrerPolicy = "strict-origin-when-cross-origin"
+	}
+	return conf
+}
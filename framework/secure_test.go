@@ -0,0 +1,120 @@
+package framework
+
+import (
+	"crypto/tls"
+	c "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCSPBuilder(t *testing.T) {
+	c.Convey("test csp builder", t, func() {
+		policy := NewCSP().
+			Add("default-src", CSPSelf).
+			Add("script-src", CSPSelf, CSPNonce).
+			Add("upgrade-insecure-requests").
+			Add("script-src", CSPStrictDynamic)
+		c.So(policy.String(), c.ShouldEqual,
+			"default-src 'self'; script-src 'self' {nonce} 'strict-dynamic'; upgrade-insecure-requests")
+	})
+}
+
+func TestSecure(t *testing.T) {
+	c.Convey("test default headers and hsts", t, func() {
+		engine := New()
+		engine.Use(SecureWithConfig(SecureConfig{STSSeconds: 3600, STSIncludeSubdomains: true, FrameOptions: "-"}))
+		engine.Get("/", func(ctx *Context) { ctx.String(http.StatusOK, "ok") })
+
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		c.So(w.Header().Get("X-Content-Type-Options"), c.ShouldEqual, "nosniff")
+		c.So(w.Header().Get("Referrer-Policy"), c.ShouldEqual, "strict-origin-when-cross-origin")
+		c.So(w.Header().Get("X-Frame-Options"), c.ShouldEqual, "")
+		c.So(w.Header().Get("Strict-Transport-Security"), c.ShouldEqual, "")
+
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.TLS = &tls.ConnectionState{}
+		w = httptest.NewRecorder()
+		engine.ServeHTTP(w, r)
+		c.So(w.Header().Get("Strict-Transport-Security"), c.ShouldEqual, "max-age=3600; includeSubDomains")
+	})
+
+	c.Convey("test allowed hosts and ssl redirect", t, func() {
+		engine := New()
+		engine.Use(SecureWithConfig(SecureConfig{AllowedHosts: []string{"example.com"}, SSLRedirect: true}))
+		ok := func(ctx *Context) { ctx.String(http.StatusOK, "ok") }
+		engine.Get("/a", ok)
+		engine.Post("/a", ok)
+
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://evil.com/a", nil))
+		c.So(w.Code, c.ShouldEqual, http.StatusBadRequest)
+
+		w = httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://example.com:80/a?b=1", nil))
+		c.So(w.Code, c.ShouldEqual, http.StatusMovedPermanently)
+		c.So(w.Header().Get("Location"), c.ShouldEqual, "https://example.com:80/a?b=1")
+
+		w = httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "http://example.com/a", nil))
+		c.So(w.Code, c.ShouldEqual, http.StatusPermanentRedirect)
+
+		// 只信任可信代理添加的X-Forwarded-Proto
+		r := httptest.NewRequest(http.MethodGet, "http://example.com/a", nil)
+		r.Header.Set("X-Forwarded-Proto", "https")
+		w = httptest.NewRecorder()
+		engine.ServeHTTP(w, r)
+		c.So(w.Code, c.ShouldEqual, http.StatusMovedPermanently)
+		c.So(engine.SetTrustedProxies([]string{"192.0.2.0/24"}), c.ShouldBeNil)
+		w = httptest.NewRecorder()
+		engine.ServeHTTP(w, r)
+		c.So(w.Code, c.ShouldEqual, http.StatusOK)
+	})
+
+	c.Convey("test ssl proxy headers from trusted proxies", t, func() {
+		engine := New()
+		engine.Use(SecureWithConfig(SecureConfig{SSLRedirect: true, SSLProxyHeaders: map[string]string{"X-Forwarded-Ssl": "on"}}))
+		engine.Get("/a", func(ctx *Context) { ctx.String(http.StatusOK, "ok") })
+		r := httptest.NewRequest(http.MethodGet, "http://example.com/a", nil)
+		r.Header.Set("X-Forwarded-Ssl", "on")
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, r)
+		c.So(w.Code, c.ShouldEqual, http.StatusMovedPermanently)
+		c.So(engine.SetTrustedProxies([]string{"192.0.2.0/24"}), c.ShouldBeNil)
+		w = httptest.NewRecorder()
+		engine.ServeHTTP(w, r)
+		c.So(w.Code, c.ShouldEqual, http.StatusOK)
+	})
+
+	c.Convey("test csp nonce in templates", t, func() {
+		engine := New()
+		engine.Use(SecureWithConfig(SecureConfig{
+			ContentSecurityPolicy: NewCSP().Add("script-src", CSPSelf, CSPNonce).String(),
+		}))
+		dir := t.TempDir()
+		tmpl := `<script nonce="{{ cspNonce }}"></script>`
+		c.So(os.WriteFile(filepath.Join(dir, "page.tmpl"), []byte(tmpl), 0644), c.ShouldBeNil)
+		engine.LoadHTMLGlob(filepath.Join(dir, "*.tmpl"))
+		var nonce string
+		engine.Get("/", func(ctx *Context) {
+			nonce = ctx.CSPNonce()
+			ctx.HTML(http.StatusOK, "page.tmpl", nil)
+		})
+
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		c.So(nonce, c.ShouldNotBeEmpty)
+		c.So(w.Header().Get("Content-Security-Policy"), c.ShouldEqual, "script-src 'self' 'nonce-"+nonce+"'")
+		c.So(w.Body.String(), c.ShouldContainSubstring, `nonce="`+nonce+`"`)
+
+		first := nonce
+		w = httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		c.So(nonce, c.ShouldNotEqual, first)
+		c.So(strings.Contains(w.Body.String(), first), c.ShouldBeFalse)
+	})
+}
@@ -0,0 +1,203 @@
+package framework
+
+import (
+	"context"
+	"crypto/tls"
+	"github.com/hiholder/geex/framework/contract"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultAddr            = ":8080"
+	defaultShutdownTimeout = 10 * time.Second
+)
+
+// ServerOptions http.Server的配置，为零值的字段依次从配置服务的app.server.*和默认值中获取
+type ServerOptions struct {
+	Addr              string        // 监听地址，对应app.server.addr
+	ReadTimeout       time.Duration // 对应app.server.read_timeout，例如"10s"
+	ReadHeaderTimeout time.Duration // 对应app.server.read_header_timeout
+	WriteTimeout      time.Duration // 对应app.server.write_timeout
+	IdleTimeout       time.Duration // 对应app.server.idle_timeout
+	MaxHeaderBytes    int           // 对应app.server.max_header_bytes
+	ShutdownTimeout   time.Duration // 收到退出信号后等待请求处理完成的最长时间，对应app.server.shutdown_timeout
+	CertFile          string        // TLS证书文件，与KeyFile同时配置时启用TLS，对应app.server.cert_file
+	KeyFile           string        // TLS私钥文件，对应app.server.key_file
+	H2C               bool          // 是否支持不加密的HTTP/2，对应app.server.h2c
+}
+
+// loadServerOptions 用配置服务和默认值补全opts中为零值的字段
+func (e *Engine) loadServerOptions(opts *ServerOptions) ServerOptions {
+	options := ServerOptions{}
+	if opts != nil {
+		options = *opts
+	}
+	var config contract.Config
+	if e.container.IsBind(contract.ConfigKey) {
+		config, _ = e.container.MustMake(contract.ConfigKey).(contract.Config)
+	}
+	duration := func(value *time.Duration, key string) {
+		if *value != 0 || config == nil || !config.IsExist(key) {
+			return
+		}
+		d, err := time.ParseDuration(config.GetString(key))
+		if err != nil {
+			log.Printf("[geex] WARNING: invalid duration %s=%v: %v", key, config.Get(key), err)
+			return
+		}
+		*value = d
+	}
+	if options.Addr == "" && config != nil && config.IsExist("app.server.addr") {
+		options.Addr = config.GetString("app.server.addr")
+	}
+	if options.MaxHeaderBytes == 0 && config != nil && config.IsExist("app.server.max_header_bytes") {
+		options.MaxHeaderBytes = config.GetInt("app.server.max_header_bytes")
+	}
+	if options.CertFile == "" && options.KeyFile == "" && config != nil {
+		options.CertFile = config.GetString("app.server.cert_file")
+		options.KeyFile = config.GetString("app.server.key_file")
+	}
+	if !options.H2C && config != nil && config.IsExist("app.server.h2c") {
+		options.H2C = config.GetBool("app.server.h2c")
+	}
+	duration(&options.ReadTimeout, "app.server.read_timeout")
+	duration(&options.ReadHeaderTimeout, "app.server.read_header_timeout")
+	duration(&options.WriteTimeout, "app.server.write_timeout")
+	duration(&options.IdleTimeout, "app.server.idle_timeout")
+	duration(&options.ShutdownTimeout, "app.server.shutdown_timeout")
+	if options.Addr == "" {
+		options.Addr = defaultAddr
+	}
+	if options.ShutdownTimeout == 0 {
+		options.ShutdownTimeout = defaultShutdownTimeout
+	}
+	return options
+}
+
+// newServer 创建http.Server并记录下来，供Shutdown使用
+func (e *Engine) newServer(options ServerOptions) *http.Server {
+	var handler http.Handler = e
+	if options.H2C {
+		handler = h2c.NewHandler(e, &http2.Server{})
+	}
+	srv := &http.Server{
+		Addr:              options.Addr,
+		Handler:           handler,
+		ReadTimeout:       options.ReadTimeout,
+		ReadHeaderTimeout: options.ReadHeaderTimeout,
+		WriteTimeout:      options.WriteTimeout,
+		IdleTimeout:       options.IdleTimeout,
+		MaxHeaderBytes:    options.MaxHeaderBytes,
+	}
+	e.serverMu.Lock()
+	e.server = srv
+	e.serverMu.Unlock()
+	if e.debug {
+		e.PrintRoutes(os.Stdout)
+	}
+	return srv
+}
+
+// RunServer 启动服务并阻塞，收到SIGINT或SIGTERM后在ShutdownTimeout内优雅退出
+// 配置了CertFile和KeyFile时使用TLS
+func (e *Engine) RunServer(opts *ServerOptions) error {
+	options := e.loadServerOptions(opts)
+	l, err := net.Listen("tcp", options.Addr)
+	if err != nil {
+		return err
+	}
+	srv := e.newServer(options)
+	return e.serveWithSignals(options.ShutdownTimeout, func() error {
+		return serve(srv, options, l)
+	})
+}
+
+// serve 在l上提供服务，配置了证书时使用TLS，证书文件变更后自动重新加载
+func serve(srv *http.Server, options ServerOptions, l net.Listener) error {
+	if options.CertFile == "" && options.KeyFile == "" {
+		return srv.Serve(l)
+	}
+	reloader, err := newCertReloader(options.CertFile, options.KeyFile)
+	if err != nil {
+		l.Close()
+		return err
+	}
+	defer reloader.Close()
+	srv.TLSConfig = &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+	return srv.ServeTLS(l, "", "")
+}
+
+// serveWithSignals 在新的goroutine中执行serve，直到serve出错或收到退出信号
+func (e *Engine) serveWithSignals(shutdownTimeout time.Duration, serve func() error) error {
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- serve()
+	}()
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(quit)
+	select {
+	case err := <-errChan:
+		// 其他地方调用了Shutdown
+		if err == http.ErrServerClosed {
+			return nil
+		}
+		return err
+	case sig := <-quit:
+		log.Printf("[geex] received signal %v, shutting down", sig)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return e.Shutdown(ctx)
+}
+
+// OnShutdown 注册关闭时执行的钩子，按注册的逆序在服务停止后执行
+func (e *Engine) OnShutdown(hook func(ctx context.Context) error) {
+	e.serverMu.Lock()
+	defer e.serverMu.Unlock()
+	e.shutdownHooks = append(e.shutdownHooks, hook)
+}
+
+// Shutdown 停止接收新请求并等待处理中的请求完成，ctx到期后强制关闭连接
+// 随后执行关闭钩子，并关闭容器中实现了io.Closer的服务，例如日志和配置服务
+// 多次调用只会执行一次
+func (e *Engine) Shutdown(ctx context.Context) error {
+	e.shutdownOnce.Do(func() {
+		e.serverMu.Lock()
+		srv, hooks := e.server, e.shutdownHooks
+		e.serverMu.Unlock()
+		var errs []error
+		if srv != nil {
+			if err := srv.Shutdown(ctx); err != nil {
+				errs = append(errs, err)
+				srv.Close()
+			}
+		}
+		for i := len(hooks) - 1; i >= 0; i-- {
+			if err := hooks[i](ctx); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if closer, ok := e.container.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if len(errs) > 0 {
+			e.shutdownErr = errs[0]
+		}
+	})
+	return e.shutdownErr
+}
@@ -0,0 +1,101 @@
+package framework
+
+import (
+	"context"
+	c "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+type closeRecorder struct {
+	closed *[]string
+}
+
+func (r closeRecorder) Close() error {
+	*r.closed = append(*r.closed, "service")
+	return nil
+}
+
+type closeRecorderProvider struct {
+	closed *[]string
+}
+
+func (p closeRecorderProvider) Name() string { return "test:closer" }
+func (p closeRecorderProvider) Register(Container) NewInstance {
+	return func(...interface{}) (interface{}, error) { return closeRecorder{closed: p.closed}, nil }
+}
+func (p closeRecorderProvider) Params(Container) []interface{} { return nil }
+func (p closeRecorderProvider) IsDefer() bool                  { return false }
+func (p closeRecorderProvider) Boot(Container) error           { return nil }
+
+func freeAddr(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+func TestServerOptions(t *testing.T) {
+	c.Convey("test server options defaults", t, func() {
+		options := New().loadServerOptions(&ServerOptions{ReadTimeout: time.Second})
+		c.So(options.Addr, c.ShouldEqual, defaultAddr)
+		c.So(options.ReadTimeout, c.ShouldEqual, time.Second)
+		c.So(options.ShutdownTimeout, c.ShouldEqual, defaultShutdownTimeout)
+	})
+}
+
+func TestShutdown(t *testing.T) {
+	c.Convey("test graceful shutdown", t, func() {
+		engine := New()
+		var closed []string
+		c.So(engine.container.Bind(closeRecorderProvider{closed: &closed}), c.ShouldBeNil)
+		engine.OnShutdown(func(ctx context.Context) error {
+			closed = append(closed, "first")
+			return nil
+		})
+		engine.OnShutdown(func(ctx context.Context) error {
+			closed = append(closed, "second")
+			return nil
+		})
+		started := make(chan struct{})
+		engine.Get("/slow", func(ctx *Context) {
+			close(started)
+			time.Sleep(50 * time.Millisecond)
+			ctx.String(http.StatusOK, "done")
+		})
+
+		addr := freeAddr(t)
+		errChan := make(chan error, 1)
+		go func() {
+			errChan <- engine.RunServer(&ServerOptions{Addr: addr})
+		}()
+		var resp *http.Response
+		var err error
+		respChan := make(chan error, 1)
+		go func() {
+			for i := 0; i < 50; i++ {
+				if resp, err = http.Get("http://" + addr + "/slow"); err == nil {
+					break
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			respChan <- err
+		}()
+		<-started
+		c.So(engine.Shutdown(context.Background()), c.ShouldBeNil)
+		c.So(<-respChan, c.ShouldBeNil)
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		c.So(string(body), c.ShouldEqual, "done")
+		c.So(<-errChan, c.ShouldBeNil)
+		c.So(closed, c.ShouldResemble, []string{"second", "first", "service"})
+		// 重复调用不会再次执行钩子
+		c.So(engine.Shutdown(context.Background()), c.ShouldBeNil)
+		c.So(closed, c.ShouldHaveLength, 3)
+	})
+}
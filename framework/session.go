@@ -0,0 +1,598 @@
+package framework
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"github.com/hiholder/geex/framework/contract"
+	gerrors "github.com/pkg/errors"
+	"github.com/spf13/cast"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// flashKey 会话中保存flash消息的键
+const flashKey = "_flash"
+
+// maxCookieSize 浏览器对单个cookie的大小限制
+const maxCookieSize = 4096
+
+type sessionKey struct{}
+
+// Session 一次请求中的会话数据，修改后在响应写出之前保存
+type Session struct {
+	mu        sync.Mutex
+	id        string
+	oldID     string // RenewID之前的ID，保存时从存储中删除
+	values    map[string]interface{}
+	isNew     bool
+	modified  bool
+	destroyed bool
+}
+
+func newSession() *Session {
+	return &Session{id: randomHex(16), values: make(map[string]interface{}), isNew: true}
+}
+
+// ID 会话ID，数据保存在cookie中时只用于区分会话
+func (s *Session) ID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.id
+}
+
+// IsNew 本次请求是否新建的会话
+func (s *Session) IsNew() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.isNew
+}
+
+func (s *Session) Get(key string) (interface{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.values[key]
+	return v, ok
+}
+
+// GetString 数据经过JSON编码，数值读出时为float64，使用类型转换的方法读取
+func (s *Session) GetString(key string) string {
+	v, _ := s.Get(key)
+	return cast.ToString(v)
+}
+
+func (s *Session) GetInt(key string) int {
+	v, _ := s.Get(key)
+	return cast.ToInt(v)
+}
+
+func (s *Session) GetBool(key string) bool {
+	v, _ := s.Get(key)
+	return cast.ToBool(v)
+}
+
+// Set 保存的值需要能够被JSON编码
+func (s *Session) Set(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = value
+	s.modified = true
+}
+
+func (s *Session) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.values[key]; ok {
+		delete(s.values, key)
+		s.modified = true
+	}
+}
+
+// Clear 清空会话数据，会话本身保留
+func (s *Session) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values = make(map[string]interface{})
+	s.modified = true
+}
+
+// AddFlash 添加一条flash消息，消息在下一次调用Flashes时读出并删除
+func (s *Session) AddFlash(value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	flashes, _ := s.values[flashKey].([]interface{})
+	s.values[flashKey] = append(flashes, value)
+	s.modified = true
+}
+
+// Flashes 读出并删除所有flash消息
+func (s *Session) Flashes() []interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	flashes, ok := s.values[flashKey].([]interface{})
+	if !ok {
+		return nil
+	}
+	delete(s.values, flashKey)
+	s.modified = true
+	return flashes
+}
+
+// RenewID 更换会话ID并保留数据，登录等权限变化之后调用，防止会话固定攻击
+func (s *Session) RenewID() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.isNew && s.oldID == "" {
+		s.oldID = s.id
+	}
+	s.id = randomHex(16)
+	s.modified = true
+}
+
+// Destroy 删除会话数据并让浏览器删除会话cookie
+func (s *Session) Destroy() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values = make(map[string]interface{})
+	s.destroyed = true
+}
+
+// SessionFromContext 获取Sessions中间件加载的会话
+func SessionFromContext(ctx context.Context) *Session {
+	s, _ := ctx.Value(sessionKey{}).(*Session)
+	return s
+}
+
+// Session 当前请求的会话，没有使用Sessions中间件时返回nil
+func (c *Context) Session() *Session {
+	if c.Req == nil {
+		return nil
+	}
+	return SessionFromContext(c.Req.Context())
+}
+
+// SessionConfig 会话中间件的配置，为零值的字段从配置服务的session.*中读取
+type SessionConfig struct {
+	Name string // cookie名，默认为"geex_session"
+	// 加密和签名cookie的密钥，第一个用于编码，其余的只用于解码，轮换时把新密钥放在最前面
+	Keys   [][]byte
+	MaxAge time.Duration // 会话有效期，默认为24小时
+	// 服务端存储，为nil时使用容器中绑定的geex:session，都没有时数据加密后保存在cookie中
+	Store contract.SessionStore
+	// 会话cookie的属性，会话cookie总是HttpOnly，SameSite默认为Lax
+	Cookie CookieOptions
+}
+
+// Sessions 使用给定的密钥创建会话中间件
+func Sessions(keys ...[]byte) HandlerFunc {
+	return SessionsWithConfig(SessionConfig{Keys: keys})
+}
+
+// SessionsWithConfig 在处理链之前加载会话，会话修改后在响应写出之前保存并写入cookie
+// 直接传入的密钥在创建中间件时检查，没有密钥时从配置服务的session.keys中读取，仍然没有时所有请求返回500
+func SessionsWithConfig(conf SessionConfig) HandlerFunc {
+	if len(conf.Keys) > 0 {
+		if _, err := NewSecureCookie(conf.MaxAge, conf.Keys...); err != nil {
+			panic(err)
+		}
+	}
+	var (
+		once    sync.Once
+		codec   *SecureCookie
+		loadErr error
+	)
+	return func(c *Context) {
+		once.Do(func() {
+			loaded := loadSessionConfig(c.container, conf)
+			if codec, loadErr = NewSecureCookie(loaded.MaxAge, loaded.Keys...); loadErr != nil {
+				log.Printf("[geex] WARNING: sessions: %v", loadErr)
+				return
+			}
+			conf = loaded
+		})
+		if loadErr != nil {
+			misconfigured(c, "sessions")
+			return
+		}
+		session := loadSession(c, &conf, codec)
+		c.Req = c.Req.WithContext(context.WithValue(c.Req.Context(), sessionKey{}, session))
+
+		// 响应头写出之前保存会话，保存后响应头才能带上Set-Cookie
+		sw := &sessionWriter{ResponseWriter: c.Writer}
+		sw.commit = func() {
+			if err := saveSession(c.Req.Context(), sw.ResponseWriter, session, &conf, codec); err != nil {
+				log.Printf("[geex] WARNING: save session failed: %v", err)
+			}
+		}
+		c.Writer = sw
+		defer func() {
+			sw.commitOnce()
+			c.Writer = sw.ResponseWriter
+		}()
+		c.Next()
+	}
+}
+
+// loadSession 从cookie和存储中读取会话，cookie无效或会话已经过期时创建新的会话
+func loadSession(c *Context, conf *SessionConfig, codec *SecureCookie) *Session {
+	value, ok := c.Cookie(conf.Name)
+	if !ok {
+		return newSession()
+	}
+	data, rotated, err := codec.Decode(conf.Name, value)
+	if err != nil {
+		return newSession()
+	}
+	session := &Session{values: make(map[string]interface{}), modified: rotated}
+	if conf.Store == nil {
+		var stored struct {
+			ID     string                 `json:"id"`
+			Values map[string]interface{} `json:"values"`
+		}
+		if json.Unmarshal(data, &stored) != nil || !validSessionID(stored.ID) {
+			return newSession()
+		}
+		session.id = stored.ID
+		if stored.Values != nil {
+			session.values = stored.Values
+		}
+		return session
+	}
+	session.id = string(data)
+	if !validSessionID(session.id) {
+		return newSession()
+	}
+	stored, err := conf.Store.Load(c.Req.Context(), session.id)
+	if err != nil {
+		log.Printf("[geex] WARNING: load session failed: %v", err)
+		return newSession()
+	}
+	// 存储中不存在的ID不再使用，防止客户端指定会话ID
+	if stored == nil || json.Unmarshal(stored, &session.values) != nil {
+		return newSession()
+	}
+	return session
+}
+
+// saveSession 会话没有修改时不写cookie，新建但为空的会话不会产生cookie
+func saveSession(ctx context.Context, w http.ResponseWriter, s *Session, conf *SessionConfig, codec *SecureCookie) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	opts := conf.Cookie
+	opts.HttpOnly = true
+	opts.MaxAge = int(conf.MaxAge / time.Second)
+	if s.destroyed {
+		if conf.Store != nil && !s.isNew {
+			if err := conf.Store.Delete(ctx, s.id); err != nil {
+				return err
+			}
+		}
+		if !s.isNew {
+			opts.MaxAge = -1
+			http.SetCookie(w, newCookie(conf.Name, "", opts))
+		}
+		return nil
+	}
+	if !s.modified || s.isNew && len(s.values) == 0 {
+		return nil
+	}
+	values, err := json.Marshal(s.values)
+	if err != nil {
+		return gerrors.WithStack(err)
+	}
+	var data []byte
+	if conf.Store == nil {
+		data, err = json.Marshal(map[string]interface{}{"id": s.id, "values": json.RawMessage(values)})
+		if err != nil {
+			return gerrors.WithStack(err)
+		}
+	} else {
+		if s.oldID != "" {
+			if err := conf.Store.Delete(ctx, s.oldID); err != nil {
+				return err
+			}
+		}
+		if err := conf.Store.Save(ctx, s.id, values, conf.MaxAge); err != nil {
+			return err
+		}
+		data = []byte(s.id)
+	}
+	value, err := codec.Encode(conf.Name, data)
+	if err != nil {
+		return err
+	}
+	if len(conf.Name)+len(value) > maxCookieSize {
+		return gerrors.Errorf("session cookie %s is %d bytes, exceeds %d", conf.Name, len(value), maxCookieSize)
+	}
+	http.SetCookie(w, newCookie(conf.Name, value, opts))
+	return nil
+}
+
+func loadSessionConfig(container Container, conf SessionConfig) SessionConfig {
+	if container != nil && container.IsBind(contract.ConfigKey) {
+		if config, ok := container.MustMake(contract.ConfigKey).(contract.Config); ok {
+			if conf.Name == "" {
+				conf.Name = config.GetString("session.name")
+			}
+			if len(conf.Keys) == 0 {
+				for _, key := range config.GetStringSlice("session.keys") {
+					conf.Keys = append(conf.Keys, []byte(key))
+				}
+			}
+			if conf.MaxAge == 0 && config.IsExist("session.max_age") {
+				d, err := time.ParseDuration(config.GetString("session.max_age"))
+				if err != nil {
+					log.Printf("[geex] WARNING: invalid duration session.max_age=%v: %v", config.Get("session.max_age"), err)
+				}
+				conf.MaxAge = d
+			}
+			if conf.Cookie.Path == "" {
+				conf.Cookie.Path = config.GetString("session.path")
+			}
+			if conf.Cookie.Domain == "" {
+				conf.Cookie.Domain = config.GetString("session.domain")
+			}
+			if !conf.Cookie.Secure {
+				conf.Cookie.Secure = config.GetBool("session.secure")
+			}
+			if conf.Cookie.SameSite == 0 {
+				conf.Cookie.SameSite = parseSameSite(config.GetString("session.same_site"))
+			}
+		}
+	}
+	if conf.Store == nil && container != nil && container.IsBind(contract.SessionKey) {
+		if store, ok := container.MustMake(contract.SessionKey).(contract.SessionStore); ok {
+			conf.Store = store
+		}
+	}
+	if conf.Name == "" {
+		conf.Name = "geex_session"
+	}
+	if conf.MaxAge <= 0 {
+		conf.MaxAge = 24 * time.Hour
+	}
+	if conf.Cookie.SameSite == 0 {
+		conf.Cookie.SameSite = http.SameSiteLaxMode
+	}
+	return conf
+}
+
+func parseSameSite(value string) http.SameSite {
+	switch strings.ToLower(value) {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	case "lax":
+		return http.SameSiteLaxMode
+	default:
+		return 0
+	}
+}
+
+// validSessionID 会话ID为32位十六进制字符串，同时用作文件名
+func validSessionID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if !('0' <= id[i] && id[i] <= '9' || 'a' <= id[i] && id[i] <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// sessionWriter 第一次写出响应时先保存会话
+type sessionWriter struct {
+	ResponseWriter
+	commit    func()
+	committed bool
+}
+
+var _ ResponseWriter = &sessionWriter{}
+
+func (w *sessionWriter) commitOnce() {
+	if !w.committed {
+		w.committed = true
+		w.commit()
+	}
+}
+
+func (w *sessionWriter) Write(data []byte) (int, error) {
+	w.commitOnce()
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *sessionWriter) WriteString(s string) (int, error) {
+	w.commitOnce()
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *sessionWriter) WriteHeaderNow() {
+	w.commitOnce()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *sessionWriter) Flush() {
+	w.commitOnce()
+	w.ResponseWriter.Flush()
+}
+
+// MemorySessionStore 保存在内存中的会话，只适用于单实例部署
+type MemorySessionStore struct {
+	mu        sync.Mutex
+	items     map[string]memorySession
+	now       func() time.Time
+	lastSweep time.Time
+}
+
+type memorySession struct {
+	data    []byte
+	expires time.Time
+}
+
+var _ contract.SessionStore = &MemorySessionStore{}
+
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{items: make(map[string]memorySession), now: time.Now}
+}
+
+func (s *MemorySessionStore) Load(ctx context.Context, id string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item, ok := s.items[id]
+	if !ok {
+		return nil, nil
+	}
+	if !s.now().Before(item.expires) {
+		delete(s.items, id)
+		return nil, nil
+	}
+	return append([]byte(nil), item.data...), nil
+}
+
+// Save 每隔ttl清理一次过期的会话
+func (s *MemorySessionStore) Save(ctx context.Context, id string, data []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if now.Sub(s.lastSweep) > ttl {
+		for key, item := range s.items {
+			if !now.Before(item.expires) {
+				delete(s.items, key)
+			}
+		}
+		s.lastSweep = now
+	}
+	s.items[id] = memorySession{data: append([]byte(nil), data...), expires: now.Add(ttl)}
+	return nil
+}
+
+func (s *MemorySessionStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.items, id)
+	return nil
+}
+
+// Len 当前保存的会话数，包括还没有被清理的过期会话
+func (s *MemorySessionStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.items)
+}
+
+// FileSessionStore 每个会话保存为目录下的一个文件，文件开头8个字节为过期时间
+type FileSessionStore struct {
+	dir string
+	now func() time.Time
+}
+
+var _ contract.SessionStore = &FileSessionStore{}
+
+// NewFileSessionStore 在dir下保存会话，目录不存在时创建
+func NewFileSessionStore(dir string) (*FileSessionStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, gerrors.WithStack(err)
+	}
+	return &FileSessionStore{dir: dir, now: time.Now}, nil
+}
+
+func (s *FileSessionStore) path(id string) (string, error) {
+	if !validSessionID(id) {
+		return "", gerrors.Errorf("invalid session id %q", id)
+	}
+	return filepath.Join(s.dir, id), nil
+}
+
+func (s *FileSessionStore) Load(ctx context.Context, id string) ([]byte, error) {
+	path, err := s.path(id)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, gerrors.WithStack(err)
+	}
+	if len(data) < 8 || s.expired(data) {
+		os.Remove(path)
+		return nil, nil
+	}
+	return data[8:], nil
+}
+
+func (s *FileSessionStore) expired(data []byte) bool {
+	return !s.now().Before(time.Unix(0, int64(binary.BigEndian.Uint64(data))))
+}
+
+// Save 先写临时文件再重命名，读取时不会读到写了一半的文件
+func (s *FileSessionStore) Save(ctx context.Context, id string, data []byte, ttl time.Duration) error {
+	path, err := s.path(id)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(s.dir, ".tmp-"+id)
+	if err != nil {
+		return gerrors.WithStack(err)
+	}
+	var expires [8]byte
+	binary.BigEndian.PutUint64(expires[:], uint64(s.now().Add(ttl).UnixNano()))
+	_, err = tmp.Write(append(expires[:], data...))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return gerrors.WithStack(err)
+	}
+	return nil
+}
+
+func (s *FileSessionStore) Delete(ctx context.Context, id string) error {
+	path, err := s.path(id)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return gerrors.WithStack(err)
+	}
+	return nil
+}
+
+// GC 删除所有过期的会话文件，可以由定时任务调用
+func (s *FileSessionStore) GC() error {
+	entries, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return gerrors.WithStack(err)
+	}
+	var header [8]byte
+	for _, entry := range entries {
+		if entry.IsDir() || !validSessionID(entry.Name()) {
+			continue
+		}
+		path := filepath.Join(s.dir, entry.Name())
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		n, _ := f.Read(header[:])
+		f.Close()
+		if n < 8 || s.expired(header[:]) {
+			os.Remove(path)
+		}
+	}
+	return nil
+}
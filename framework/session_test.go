@@ -0,0 +1,207 @@
+package framework
+
+import (
+	"context"
+	c "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSetCookie(t *testing.T) {
+	c.Convey("test set and delete cookie", t, func() {
+		w := httptest.NewRecorder()
+		ctx := newContext(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		ctx.SetCookie("a", "1", CookieOptions{MaxAge: 60, HttpOnly: true, SameSite: http.SameSiteNoneMode})
+		ctx.DeleteCookie("b", CookieOptions{Path: "/admin"})
+		cookies := w.Result().Cookies()
+		c.So(cookies, c.ShouldHaveLength, 2)
+		c.So(cookies[0].Path, c.ShouldEqual, "/")
+		c.So(cookies[0].HttpOnly, c.ShouldBeTrue)
+		c.So(cookies[0].Secure, c.ShouldBeTrue)
+		c.So(cookies[0].SameSite, c.ShouldEqual, http.SameSiteNoneMode)
+		c.So(cookies[1].MaxAge, c.ShouldBeLessThan, 0)
+		c.So(cookies[1].Path, c.ShouldEqual, "/admin")
+	})
+}
+
+func TestSecureCookie(t *testing.T) {
+	c.Convey("test encode, tamper and key rotation", t, func() {
+		oldCodec, err := NewSecureCookie(time.Hour, []byte("old-key"))
+		c.So(err, c.ShouldBeNil)
+		value, err := oldCodec.Encode("sid", []byte("hello"))
+		c.So(err, c.ShouldBeNil)
+
+		_, _, err = oldCodec.Decode("other", value)
+		c.So(err, c.ShouldEqual, ErrCookieInvalid)
+		_, _, err = oldCodec.Decode("sid", value[:len(value)-2]+"AA")
+		c.So(err, c.ShouldEqual, ErrCookieInvalid)
+
+		codec, _ := NewSecureCookie(time.Hour, []byte("new-key"), []byte("old-key"))
+		data, rotated, err := codec.Decode("sid", value)
+		c.So(err, c.ShouldBeNil)
+		c.So(string(data), c.ShouldEqual, "hello")
+		c.So(rotated, c.ShouldBeTrue)
+
+		value, _ = codec.Encode("sid", []byte("hello"))
+		_, rotated, err = codec.Decode("sid", value)
+		c.So(rotated, c.ShouldBeFalse)
+		_, _, err = oldCodec.Decode("sid", value)
+		c.So(err, c.ShouldEqual, ErrCookieInvalid)
+
+		_, err = NewSecureCookie(0)
+		c.So(err, c.ShouldNotBeNil)
+	})
+}
+
+// sessionClient 在请求之间保存cookie
+type sessionClient struct {
+	engine  *Engine
+	cookies map[string]*http.Cookie
+}
+
+func (s *sessionClient) get(path string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	for _, cookie := range s.cookies {
+		r.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	s.engine.ServeHTTP(w, r)
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.MaxAge < 0 {
+			delete(s.cookies, cookie.Name)
+			continue
+		}
+		s.cookies[cookie.Name] = cookie
+	}
+	return w
+}
+
+func newSessionEngine(conf SessionConfig) *sessionClient {
+	engine := New()
+	engine.Use(SessionsWithConfig(conf))
+	engine.Get("/set", func(ctx *Context) {
+		ctx.Session().Set("user", ctx.Query("user"))
+		ctx.Session().AddFlash("welcome")
+		ctx.String(http.StatusOK, "ok")
+	})
+	engine.Get("/get", func(ctx *Context) {
+		s := ctx.Session()
+		ctx.String(http.StatusOK, "%s %v", s.GetString("user"), s.Flashes())
+	})
+	engine.Get("/login", func(ctx *Context) {
+		ctx.Session().RenewID()
+		ctx.Status(http.StatusNoContent)
+	})
+	engine.Get("/logout", func(ctx *Context) {
+		ctx.Session().Destroy()
+		ctx.Status(http.StatusNoContent)
+	})
+	return &sessionClient{engine: engine, cookies: make(map[string]*http.Cookie)}
+}
+
+func TestSessions(t *testing.T) {
+	c.Convey("test cookie store with flash messages", t, func() {
+		client := newSessionEngine(SessionConfig{Keys: [][]byte{[]byte("k1")}})
+		w := client.get("/get")
+		c.So(w.Body.String(), c.ShouldEqual, " []")
+		c.So(w.Header().Get("Set-Cookie"), c.ShouldEqual, "")
+
+		client.get("/set?user=geex")
+		cookie := client.cookies["geex_session"]
+		c.So(cookie, c.ShouldNotBeNil)
+		c.So(cookie.HttpOnly, c.ShouldBeTrue)
+		c.So(cookie.SameSite, c.ShouldEqual, http.SameSiteLaxMode)
+
+		c.So(client.get("/get").Body.String(), c.ShouldEqual, "geex [welcome]")
+		c.So(client.get("/get").Body.String(), c.ShouldEqual, "geex []")
+
+		// 轮换密钥后旧cookie仍然有效，并被重新编码
+		rotated := newSessionEngine(SessionConfig{Keys: [][]byte{[]byte("k2"), []byte("k1")}})
+		rotated.cookies = client.cookies
+		w = rotated.get("/get")
+		c.So(w.Body.String(), c.ShouldEqual, "geex []")
+		c.So(w.Header().Get("Set-Cookie"), c.ShouldNotEqual, "")
+		dropped := newSessionEngine(SessionConfig{Keys: [][]byte{[]byte("k3")}})
+		dropped.cookies = rotated.cookies
+		c.So(dropped.get("/get").Body.String(), c.ShouldEqual, " []")
+
+		rotated.get("/logout")
+		c.So(rotated.cookies, c.ShouldBeEmpty)
+	})
+
+	c.Convey("test server side store from container", t, func() {
+		store := NewMemorySessionStore()
+		client := newSessionEngine(SessionConfig{Keys: [][]byte{[]byte("k1")}})
+		c.So(client.engine.Bind(instanceProvider{name: "geex:session", instance: store}), c.ShouldBeNil)
+
+		client.get("/set?user=geex")
+		c.So(store.Len(), c.ShouldEqual, 1)
+		first := client.cookies["geex_session"].Value
+
+		client.get("/login")
+		c.So(client.cookies["geex_session"].Value, c.ShouldNotEqual, first)
+		c.So(store.Len(), c.ShouldEqual, 1)
+		c.So(client.get("/get").Body.String(), c.ShouldEqual, "geex [welcome]")
+
+		client.get("/logout")
+		c.So(store.Len(), c.ShouldEqual, 0)
+		c.So(client.cookies, c.ShouldBeEmpty)
+	})
+}
+
+func TestSessionStores(t *testing.T) {
+	id := randomHex(16)
+	ctx := context.Background()
+	c.Convey("test sessions without keys", t, func() {
+		c.So(func() { Sessions([]byte{}) }, c.ShouldPanic)
+		// 配置服务中也没有密钥时每个请求都返回500，不会继续使用未初始化的配置
+		engine := New()
+		engine.Use(SessionsWithConfig(SessionConfig{}))
+		engine.Get("/", func(ctx *Context) {
+			ctx.Session().Set("user", "tom")
+			ctx.String(http.StatusOK, "ok")
+		})
+		for i := 0; i < 2; i++ {
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			c.So(w.Code, c.ShouldEqual, http.StatusInternalServerError)
+			c.So(w.Result().Cookies(), c.ShouldBeEmpty)
+		}
+	})
+
+	c.Convey("test memory store expiration", t, func() {
+		now := time.Unix(0, 0)
+		store := NewMemorySessionStore()
+		store.now = func() time.Time { return now }
+		c.So(store.Save(ctx, id, []byte("data"), time.Minute), c.ShouldBeNil)
+		data, err := store.Load(ctx, id)
+		c.So(err, c.ShouldBeNil)
+		c.So(string(data), c.ShouldEqual, "data")
+		now = now.Add(time.Minute)
+		data, _ = store.Load(ctx, id)
+		c.So(data, c.ShouldBeNil)
+		c.So(store.Len(), c.ShouldEqual, 0)
+	})
+
+	c.Convey("test file store", t, func() {
+		now := time.Unix(0, 0)
+		store, err := NewFileSessionStore(t.TempDir())
+		c.So(err, c.ShouldBeNil)
+		store.now = func() time.Time { return now }
+		c.So(store.Save(ctx, id, []byte("data"), time.Minute), c.ShouldBeNil)
+		data, err := store.Load(ctx, id)
+		c.So(err, c.ShouldBeNil)
+		c.So(string(data), c.ShouldEqual, "data")
+		_, err = store.Load(ctx, "../../etc/passwd")
+		c.So(err, c.ShouldNotBeNil)
+
+		now = now.Add(time.Minute)
+		c.So(store.GC(), c.ShouldBeNil)
+		data, err = store.Load(ctx, id)
+		c.So(err, c.ShouldBeNil)
+		c.So(data, c.ShouldBeNil)
+		c.So(store.Delete(ctx, id), c.ShouldBeNil)
+	})
+}
@@ -0,0 +1,144 @@
+package framework
+
+import (
+	"context"
+	"github.com/spf13/cast"
+	"sync"
+	"time"
+)
+
+// contextStore 请求范围内的键值存储，超时中间件fork出的Context与原Context共用同一个store
+type contextStore struct {
+	mu   sync.RWMutex
+	keys map[string]interface{}
+}
+
+func (s *contextStore) reset() {
+	s.mu.Lock()
+	for key := range s.keys {
+		delete(s.keys, key)
+	}
+	s.mu.Unlock()
+}
+
+var _ context.Context = &Context{}
+
+// Set 保存请求范围内的数据，用于中间件向后续的处理函数传递数据
+func (c *Context) Set(key string, value interface{}) {
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+	if c.store.keys == nil {
+		c.store.keys = make(map[string]interface{})
+	}
+	c.store.keys[key] = value
+}
+
+// Get 获取Set保存的数据
+func (c *Context) Get(key string) (value interface{}, exists bool) {
+	c.store.mu.RLock()
+	defer c.store.mu.RUnlock()
+	value, exists = c.store.keys[key]
+	return
+}
+
+// MustGet 获取Set保存的数据，不存在时panic
+func (c *Context) MustGet(key string) interface{} {
+	if value, exists := c.Get(key); exists {
+		return value
+	}
+	panic("key \"" + key + "\" does not exist")
+}
+
+// 以下方法获取Set保存的数据并转换为对应的类型，不存在或无法转换时返回零值
+
+func (c *Context) GetString(key string) string {
+	value, _ := c.Get(key)
+	return cast.ToString(value)
+}
+
+func (c *Context) GetBool(key string) bool {
+	value, _ := c.Get(key)
+	return cast.ToBool(value)
+}
+
+func (c *Context) GetInt(key string) int {
+	value, _ := c.Get(key)
+	return cast.ToInt(value)
+}
+
+func (c *Context) GetInt64(key string) int64 {
+	value, _ := c.Get(key)
+	return cast.ToInt64(value)
+}
+
+func (c *Context) GetUint(key string) uint {
+	value, _ := c.Get(key)
+	return cast.ToUint(value)
+}
+
+func (c *Context) GetUint64(key string) uint64 {
+	value, _ := c.Get(key)
+	return cast.ToUint64(value)
+}
+
+func (c *Context) GetFloat64(key string) float64 {
+	value, _ := c.Get(key)
+	return cast.ToFloat64(value)
+}
+
+func (c *Context) GetTime(key string) time.Time {
+	value, _ := c.Get(key)
+	return cast.ToTime(value)
+}
+
+func (c *Context) GetDuration(key string) time.Duration {
+	value, _ := c.Get(key)
+	return cast.ToDuration(value)
+}
+
+func (c *Context) GetIntSlice(key string) []int {
+	value, _ := c.Get(key)
+	return cast.ToIntSlice(value)
+}
+
+func (c *Context) GetStringSlice(key string) []string {
+	value, _ := c.Get(key)
+	return cast.ToStringSlice(value)
+}
+
+func (c *Context) GetStringMap(key string) map[string]interface{} {
+	value, _ := c.Get(key)
+	return cast.ToStringMap(value)
+}
+
+func (c *Context) GetStringMapString(key string) map[string]string {
+	value, _ := c.Get(key)
+	return cast.ToStringMapString(value)
+}
+
+func (c *Context) GetStringMapStringSlice(key string) map[string][]string {
+	value, _ := c.Get(key)
+	return cast.ToStringMapStringSlice(value)
+}
+
+// Err 实现context.Context，返回请求context的错误
+func (c *Context) Err() error {
+	if c.Req == nil {
+		return nil
+	}
+	return c.Req.Context().Err()
+}
+
+// Value 实现context.Context，字符串类型的key先查找Set保存的数据，再查找请求的context
+// 因此Context可以直接传给contract.Log的Ctx*方法，由CtxFields读取请求范围内的数据
+func (c *Context) Value(key interface{}) interface{} {
+	if k, ok := key.(string); ok {
+		if value, exists := c.Get(k); exists {
+			return value
+		}
+	}
+	if c.Req == nil {
+		return nil
+	}
+	return c.Req.Context().Value(key)
+}
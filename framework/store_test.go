@@ -0,0 +1,72 @@
+package framework
+
+import (
+	"context"
+	c "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type ctxKey struct{}
+
+func TestContextStore(t *testing.T) {
+	c.Convey("test context key/value store", t, func() {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r = r.WithContext(context.WithValue(r.Context(), ctxKey{}, "from request"))
+		ctx := newContext(httptest.NewRecorder(), r)
+		ctx.Set("user", "geex")
+		ctx.Set("id", "42")
+		ctx.Set("born", "2020-01-02")
+		ctx.Set("meta", map[string]interface{}{"a": 1})
+
+		user, ok := ctx.Get("user")
+		c.So(ok, c.ShouldBeTrue)
+		c.So(user, c.ShouldEqual, "geex")
+		c.So(ctx.GetInt64("id"), c.ShouldEqual, 42)
+		c.So(ctx.GetTime("born").Year(), c.ShouldEqual, 2020)
+		c.So(ctx.GetStringMap("meta"), c.ShouldResemble, map[string]interface{}{"a": 1})
+		c.So(ctx.GetString("missing"), c.ShouldBeEmpty)
+		c.So(func() { ctx.MustGet("missing") }, c.ShouldPanic)
+
+		// Value先查找store，再查找请求的context
+		var stdCtx context.Context = ctx
+		c.So(stdCtx.Value("user"), c.ShouldEqual, "geex")
+		c.So(stdCtx.Value(ctxKey{}), c.ShouldEqual, "from request")
+		c.So(stdCtx.Err(), c.ShouldBeNil)
+
+		ctx.reset(httptest.NewRecorder(), r)
+		_, ok = ctx.Get("user")
+		c.So(ok, c.ShouldBeFalse)
+	})
+
+	c.Convey("test store shared with timeout goroutine", t, func() {
+		engine := New()
+		var handler string
+		engine.Use(func(ctx *Context) {
+			ctx.Set("from", "middleware")
+			ctx.Next()
+			handler = ctx.GetString("handler")
+		}, Timeout(time.Second, nil))
+		engine.Get("/", func(ctx *Context) {
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					ctx.Set("n", i)
+					ctx.GetInt("n")
+				}(i)
+			}
+			wg.Wait()
+			ctx.Set("handler", "done")
+			ctx.String(http.StatusOK, ctx.GetString("from"))
+		})
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		c.So(w.Body.String(), c.ShouldEqual, "middleware")
+		c.So(handler, c.ShouldEqual, "done")
+	})
+}
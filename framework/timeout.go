@@ -0,0 +1,87 @@
+package framework
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Timeout 超时中间件，在新的goroutine中以带超时的context执行后续的处理链
+// 超时后由onTimeout写出响应，onTimeout为nil时返回504，之后处理链中的渲染方法都不再写入
+// 后续处理链中的panic连同调用栈传回当前goroutine，由外层的Recovery处理
+func Timeout(d time.Duration, onTimeout HandlerFunc) HandlerFunc {
+	if onTimeout == nil {
+		onTimeout = gatewayTimeout
+	}
+	return func(c *Context) {
+		ctx, cancel := context.WithTimeout(c.Req.Context(), d)
+		defer cancel()
+		// 后续处理链在hc上执行，hc与c共用Writer，但拥有独立的index和写保护
+		hc := c.fork(c.Req.WithContext(ctx))
+		finish := make(chan struct{}, 1)
+		panicChan := make(chan interface{}, 1)
+		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					if p != http.ErrAbortHandler {
+						p = &stackPanic{value: p, frames: stack()}
+					}
+					panicChan <- p
+				}
+			}()
+			hc.Next()
+			finish <- struct{}{}
+		}()
+		select {
+		case p := <-panicChan:
+			c.Abort()
+			panic(p)
+		case <-finish:
+			c.index = hc.index
+			c.StatusCode = hc.StatusCode
+			// 请求体只能读取一次，把解析结果带回外层，请求结束时由ServeHTTP清理临时文件
+			if hc.Req.MultipartForm != nil {
+				c.Req.MultipartForm = hc.Req.MultipartForm
+				c.Req.Form, c.Req.PostForm = hc.Req.Form, hc.Req.PostForm
+			}
+		case <-ctx.Done():
+			hc.writerMux.Lock()
+			hc.hasTimeout = true
+			written := hc.Writer.Written()
+			hc.writerMux.Unlock()
+			c.Abort()
+			// 响应已经开始写出时无法再返回超时响应
+			// hc所在的goroutine可能还在执行，请求结束后c不能被复用
+			c.detached = true
+			if !written && ctx.Err() == context.DeadlineExceeded {
+				onTimeout(c)
+			}
+		}
+	}
+}
+
+// fork 复制一个用于在其他goroutine中执行处理链的Context，共用响应和请求数据
+// 路由参数单独复制一份，不受c被复用的影响，键值存储共用，两边Set的数据互相可见
+func (c *Context) fork(req *http.Request) *Context {
+	return &Context{
+		Writer:     c.Writer,
+		Req:        req,
+		Path:       c.Path,
+		Method:     c.Method,
+		Params:     append(Params(nil), c.Params...),
+		fullPath:   c.fullPath,
+		StatusCode: c.StatusCode,
+		handlers:   c.handlers,
+		index:      c.index,
+		engine:     c.engine,
+		writerMux:  &sync.Mutex{},
+		container:  c.container,
+		store:      c.store,
+		htmlFuncs:  c.htmlFuncs,
+	}
+}
+
+func gatewayTimeout(c *Context) {
+	errorResponse(c, http.StatusGatewayTimeout, "504 GATEWAY TIMEOUT")
+}
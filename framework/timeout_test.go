@@ -0,0 +1,62 @@
+package framework
+
+import (
+	c "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTimeout(t *testing.T) {
+	c.Convey("test timeout middleware", t, func() {
+		engine := New()
+		engine.Use(Recovery(), Timeout(20*time.Millisecond, nil))
+		done := make(chan bool, 1)
+		engine.Get("/slow", func(ctx *Context) {
+			<-ctx.Done()
+			time.Sleep(10 * time.Millisecond)
+			ctx.String(http.StatusOK, "late")
+			ctx.Data(http.StatusOK, []byte("late"))
+			ctx.Xml(http.StatusOK, renderItem{A: 1})
+			ctx.SetHeader("X-Late", "1")
+			done <- ctx.HasTimeout()
+		})
+		engine.Get("/fast", func(ctx *Context) {
+			ctx.String(http.StatusOK, "fast")
+		}, func(ctx *Context) {
+			ctx.String(http.StatusOK, " next")
+		})
+		engine.Get("/panic", func(ctx *Context) {
+			panic("boom")
+		})
+
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+		c.So(<-done, c.ShouldBeTrue)
+		c.So(w.Code, c.ShouldEqual, http.StatusGatewayTimeout)
+		c.So(w.Body.String(), c.ShouldEqual, "504 GATEWAY TIMEOUT\n")
+		c.So(w.Header().Get("X-Late"), c.ShouldBeEmpty)
+
+		w = httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/fast", nil))
+		c.So(w.Code, c.ShouldEqual, http.StatusOK)
+		c.So(w.Body.String(), c.ShouldEqual, "fast next")
+
+		w = httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+		c.So(w.Code, c.ShouldEqual, http.StatusInternalServerError)
+	})
+
+	c.Convey("test custom timeout handler", t, func() {
+		engine := New()
+		engine.Get("/slow", Timeout(time.Millisecond, func(ctx *Context) {
+			ctx.JSON(http.StatusServiceUnavailable, H{"message": "busy"})
+		}), func(ctx *Context) {
+			<-ctx.Done()
+		})
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+		c.So(w.Code, c.ShouldEqual, http.StatusServiceUnavailable)
+	})
+}
@@ -0,0 +1,180 @@
+package framework
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+)
+
+const (
+	HeaderRequestID   = "X-Request-ID"
+	HeaderTraceparent = "traceparent"
+	HeaderTracestate  = "tracestate"
+)
+
+// 请求ID最大长度，超过时重新生成，避免客户端传入过长的值写入日志
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+type traceKey struct{}
+
+// TraceContext W3C Trace Context中的链路信息
+type TraceContext struct {
+	TraceID  string // 32位十六进制的链路ID
+	SpanID   string // 当前服务处理该请求的span ID
+	ParentID string // 上游的span ID，请求中没有traceparent时为空
+	Flags    string // trace-flags，"01"表示采样
+	State    string // tracestate原样透传
+}
+
+// Traceparent 按W3C格式输出当前span的traceparent
+func (tc TraceContext) Traceparent() string {
+	return "00-" + tc.TraceID + "-" + tc.SpanID + "-" + tc.Flags
+}
+
+// Sampled 上游是否要求采样
+func (tc TraceContext) Sampled() bool {
+	b, err := hex.DecodeString(tc.Flags)
+	return err == nil && len(b) == 1 && b[0]&0x01 == 1
+}
+
+// ParseTraceparent 解析traceparent请求头，格式为version-trace_id-parent_id-flags
+// 返回的TraceContext中ParentID为请求中的span ID，SpanID为空
+func ParseTraceparent(value string) (TraceContext, bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 {
+		return TraceContext{}, false
+	}
+	version, traceID, parentID, flags := parts[0], parts[1], parts[2], parts[3]
+	// 00版本只能有4段，更高的版本允许在后面追加字段
+	if !isLowerHex(version, 2) || version == "ff" || (version == "00" && len(parts) != 4) {
+		return TraceContext{}, false
+	}
+	if !isLowerHex(traceID, 32) || !isLowerHex(parentID, 16) || !isLowerHex(flags, 2) {
+		return TraceContext{}, false
+	}
+	if strings.Trim(traceID, "0") == "" || strings.Trim(parentID, "0") == "" {
+		return TraceContext{}, false
+	}
+	return TraceContext{TraceID: traceID, ParentID: parentID, Flags: flags}, true
+}
+
+func isLowerHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// randomHex 生成n字节的随机数，以十六进制输出
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// validRequestID 请求ID只允许可见的ASCII字符
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// RequestIDConfig RequestID中间件的配置
+type RequestIDConfig struct {
+	Header    string        // 读取和返回请求ID的请求头，默认为X-Request-ID
+	Generator func() string // 请求中没有合法的请求ID时生成新的ID，默认为16字节的随机数
+}
+
+// RequestID 读取或生成请求ID，并解析W3C traceparent和tracestate
+func RequestID() HandlerFunc {
+	return RequestIDWithConfig(RequestIDConfig{})
+}
+
+// RequestIDWithConfig 读取或生成请求ID，并解析W3C traceparent和tracestate
+// 请求ID和链路信息保存在请求的context中，通过RequestIDFromContext和TraceFromContext获取，并写入响应头
+// 请求中没有合法的traceparent时开始新的链路
+func RequestIDWithConfig(conf RequestIDConfig) HandlerFunc {
+	if conf.Header == "" {
+		conf.Header = HeaderRequestID
+	}
+	if conf.Generator == nil {
+		conf.Generator = func() string {
+			return randomHex(16)
+		}
+	}
+	return func(c *Context) {
+		id := c.Req.Header.Get(conf.Header)
+		if !validRequestID(id) {
+			id = conf.Generator()
+		}
+		tc, ok := ParseTraceparent(c.Req.Header.Get(HeaderTraceparent))
+		if ok {
+			tc.State = c.Req.Header.Get(HeaderTracestate)
+		} else {
+			tc = TraceContext{TraceID: randomHex(16), Flags: "00"}
+		}
+		tc.SpanID = randomHex(8)
+
+		ctx := context.WithValue(c.Req.Context(), requestIDKey{}, id)
+		ctx = context.WithValue(ctx, traceKey{}, tc)
+		c.Req = c.Req.WithContext(ctx)
+
+		header := c.Writer.Header()
+		header.Set(conf.Header, id)
+		header.Set(HeaderTraceparent, tc.Traceparent())
+		if tc.State != "" {
+			header.Set(HeaderTracestate, tc.State)
+		}
+		c.Next()
+	}
+}
+
+// RequestIDFromContext 获取RequestID中间件保存的请求ID，*Context也可以直接传入
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// TraceFromContext 获取RequestID中间件保存的链路信息，*Context也可以直接传入
+func TraceFromContext(ctx context.Context) (TraceContext, bool) {
+	tc, ok := ctx.Value(traceKey{}).(TraceContext)
+	return tc, ok
+}
+
+// RequestID 当前请求的ID，没有使用RequestID中间件时为空
+func (c *Context) RequestID() string {
+	return RequestIDFromContext(c)
+}
+
+// TraceCtxFields 实现contract.CtxFields，从context中获取request_id、trace_id和span_id作为日志字段
+func TraceCtxFields(ctx context.Context) map[string]interface{} {
+	if ctx == nil {
+		return nil
+	}
+	fields := make(map[string]interface{}, 3)
+	if id := RequestIDFromContext(ctx); id != "" {
+		fields["request_id"] = id
+	}
+	if tc, ok := TraceFromContext(ctx); ok {
+		fields["trace_id"] = tc.TraceID
+		fields["span_id"] = tc.SpanID
+	}
+	return fields
+}
@@ -0,0 +1,79 @@
+package framework
+
+import (
+	c "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	c.Convey("test parse traceparent", t, func() {
+		tc, ok := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		c.So(ok, c.ShouldBeTrue)
+		c.So(tc.TraceID, c.ShouldEqual, "4bf92f3577b34da6a3ce929d0e0e4736")
+		c.So(tc.ParentID, c.ShouldEqual, "00f067aa0ba902b7")
+		c.So(tc.Sampled(), c.ShouldBeTrue)
+
+		_, ok = ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra")
+		c.So(ok, c.ShouldBeTrue)
+		for _, value := range []string{
+			"",
+			"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+			"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+			"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+			"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+			"00-4bf92f3577b34da6-00f067aa0ba902b7-01",
+		} {
+			_, ok = ParseTraceparent(value)
+			c.So(ok, c.ShouldBeFalse)
+		}
+	})
+}
+
+func TestRequestID(t *testing.T) {
+	c.Convey("test request id and trace propagation", t, func() {
+		engine := New()
+		engine.Use(RequestID())
+		var fields map[string]interface{}
+		engine.Get("/", func(ctx *Context) {
+			fields = TraceCtxFields(ctx)
+			ctx.String(http.StatusOK, ctx.RequestID())
+		})
+
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set(HeaderRequestID, "req-1")
+		r.Header.Set(HeaderTraceparent, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		r.Header.Set(HeaderTracestate, "vendor=value")
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, r)
+		c.So(w.Body.String(), c.ShouldEqual, "req-1")
+		c.So(w.Header().Get(HeaderRequestID), c.ShouldEqual, "req-1")
+		c.So(w.Header().Get(HeaderTracestate), c.ShouldEqual, "vendor=value")
+		tc, ok := ParseTraceparent(w.Header().Get(HeaderTraceparent))
+		c.So(ok, c.ShouldBeTrue)
+		c.So(tc.TraceID, c.ShouldEqual, "4bf92f3577b34da6a3ce929d0e0e4736")
+		// 响应中是当前服务的span
+		c.So(tc.ParentID, c.ShouldNotEqual, "00f067aa0ba902b7")
+		c.So(fields, c.ShouldResemble, map[string]interface{}{
+			"request_id": "req-1",
+			"trace_id":   "4bf92f3577b34da6a3ce929d0e0e4736",
+			"span_id":    tc.ParentID,
+		})
+
+		// 没有或不合法的请求ID和traceparent时重新生成
+		r = httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set(HeaderRequestID, "bad id\n"+strings.Repeat("x", 200))
+		r.Header.Set(HeaderTraceparent, "garbage")
+		w = httptest.NewRecorder()
+		engine.ServeHTTP(w, r)
+		c.So(w.Body.String(), c.ShouldHaveLength, 32)
+		c.So(w.Header().Get(HeaderRequestID), c.ShouldEqual, w.Body.String())
+		tc, ok = ParseTraceparent(w.Header().Get(HeaderTraceparent))
+		c.So(ok, c.ShouldBeTrue)
+		c.So(tc.Sampled(), c.ShouldBeFalse)
+		c.So(fields["trace_id"], c.ShouldEqual, tc.TraceID)
+	})
+}
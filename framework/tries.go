@@ -5,185 +5,308 @@ import (
 	"strings"
 )
 
+// Tree 压缩前缀树(radix tree)，每个HTTP方法对应一棵
+// 匹配优先级固定为: 静态路由 > :param > *catchall，与注册顺序无关
 type Tree struct {
-	root *node
+	root      *node
+	maxParams int // 所有路由中参数个数的最大值，用于预分配参数切片
 }
 
+type nodeType uint8
+
+const (
+	static nodeType = iota
+	root
+	param
+	catchAll
+)
+
 type node struct {
-	pattern  string      // 待匹配路由
-	part     string      // 路由中的一部分
-	children []*node     // 子节点
-	isWild   bool        // 是否精准匹配
-	isLast   bool        // 是否是最后一个
-	handler  HandlerFunc // 将handler放到节点上
+	path          string        // 静态节点为压缩后的公共前缀，参数节点为":name"，通配节点为"*name"
+	nType         nodeType      // 节点类型
+	indices       string        // 静态子节点path的首字符，与children一一对应
+	children      []*node       // 静态子节点
+	paramChild    *node         // ":param"子节点，同一位置只能有一个
+	catchAllChild *node         // "*catchall"子节点，同一位置只能有一个
+	pattern       string        // 完整路由，只有可以匹配的节点才有
+	handlers      []HandlerFunc // 路由对应的处理链，包括路由级中间件和最终的handler
+}
+
+// Param 路由参数
+type Param struct {
+	Key   string
+	Value string
 }
 
-func newNode() *node {
-	return &node{
-		isLast:   false,
-		part:     "",
-		children: make([]*node, 0),
+// Params 路由参数列表，按在路由中出现的顺序排列
+type Params []Param
+
+// Get 获取参数值
+func (ps Params) Get(key string) (string, bool) {
+	for _, p := range ps {
+		if p.Key == key {
+			return p.Value, true
+		}
 	}
+	return "", false
+}
+
+// ByName 获取参数值，不存在时返回空字符串
+func (ps Params) ByName(key string) string {
+	v, _ := ps.Get(key)
+	return v
 }
 
 func NewTree() *Tree {
-	root := newNode()
-	return &Tree{root}
+	return &Tree{root: &node{nType: root}}
 }
 
-// 找的第一个匹配的节点
-func (n *node) matchChild(part string) *node {
-	if len(n.children) == 0 {
-		return nil
-	}
-	for _, child := range n.children {
-		if child.part == part || child.isWild {
-			return child
-		}
-	}
-	return nil
+// segment 路由按通配符拆分后的一段
+type segment struct {
+	path  string
+	nType nodeType
 }
 
-// 找到所有匹配的节点，用于查找
-func (n *node) matchChildren(part string) []*node {
-	if len(n.children) == 0 {
-		return nil
+// splitPattern 将路由拆分为静态段和通配段，并校验通配符的位置
+// 例如"/user/:id/edit"拆分为"/user/"、":id"、"/edit"
+func splitPattern(path string) ([]segment, int, error) {
+	if path == "" || path[0] != '/' {
+		return nil, 0, fmt.Errorf("invalid path=%v, path must begin with '/'", path)
 	}
-	// 获取下一层符合的节点
-	nodeList := make([]*node, 0, len(n.children))
-	for _, child := range n.children {
-		if child.part == part || child.isWild {
-			nodeList = append(nodeList, child)
+	var (
+		segments []segment
+		names    = make(map[string]bool)
+		start    = 0
+	)
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if c != ':' && c != '*' {
+			continue
 		}
+		if path[i-1] != '/' {
+			return nil, 0, fmt.Errorf("wildcard must begin a segment, path=%v", path)
+		}
+		end := i + 1
+		for end < len(path) && path[end] != '/' {
+			if path[end] == ':' || path[end] == '*' {
+				return nil, 0, fmt.Errorf("only one wildcard per segment is allowed, path=%v", path)
+			}
+			end++
+		}
+		name := path[i+1 : end]
+		if name == "" {
+			return nil, 0, fmt.Errorf("wildcard %q must have a name, path=%v", string(c), path)
+		}
+		if names[name] {
+			return nil, 0, fmt.Errorf("duplicate wildcard name %q, path=%v", name, path)
+		}
+		names[name] = true
+		nType := param
+		if c == '*' {
+			if end != len(path) {
+				return nil, 0, fmt.Errorf("invalid * position, catch-all must be the last segment, path=%v", path)
+			}
+			nType = catchAll
+		}
+		segments = append(segments, segment{path: path[start:i], nType: static}, segment{path: path[i:end], nType: nType})
+		start, i = end, end-1
+	}
+	if start < len(path) {
+		segments = append(segments, segment{path: path[start:], nType: static})
 	}
-	return nodeList
+	return segments, len(names), nil
 }
 
-func (n *node) insert(pattern string, parts []string, height int) {
-	// trie树的高度等于匹配路由长度认为已经匹配完成
-	if height == len(parts) {
-		// 可以匹配的节点才会有pattern
-		n.pattern = pattern
-		return
+// longestCommonPrefix 两个字符串公共前缀的长度
+func longestCommonPrefix(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
 	}
-	part := parts[height]
-	child := n.matchChild(part)
-	if child == nil {
-		child = &node{
-			part:   part,
-			isWild: part[0] == ':' || part[0] == '*',
+	return i
+}
+
+// insertStatic 在n的静态子节点中插入path，必要时分裂已有节点，返回path结尾处的节点
+func (n *node) insertStatic(path string) *node {
+	for path != "" {
+		i := strings.IndexByte(n.indices, path[0])
+		if i < 0 {
+			child := &node{path: path, nType: static}
+			n.indices += string(path[0])
+			n.children = append(n.children, child)
+			return child
+		}
+		child := n.children[i]
+		l := longestCommonPrefix(path, child.path)
+		if l < len(child.path) {
+			// 分裂节点: 公共前缀保留在child上，剩余部分下沉为新的子节点
+			rest := *child
+			rest.path = child.path[l:]
+			*child = node{
+				path:     child.path[:l],
+				nType:    static,
+				indices:  string(rest.path[0]),
+				children: []*node{&rest},
+			}
 		}
-		n.children = append(n.children, child)
+		path = path[l:]
+		n = child
 	}
-	child.insert(pattern, parts, height+1)
-	return
+	return n
 }
 
-// 根据part数组查找对应的节点
-func (n *node) search(parts []string, height int) *node {
-	if len(parts) == height || strings.HasPrefix(n.part, "*") {
-		if n.pattern == "" {
-			return nil
-		}
-		return n
+func (tree *Tree) AddRouter(path string, handlers []HandlerFunc) error {
+	if len(handlers) == 0 {
+		return fmt.Errorf("there must be at least one handler, path=%v", path)
+	}
+	segments, paramCount, err := splitPattern(path)
+	if err != nil {
+		return err
 	}
-	part := parts[height]
-	children := n.matchChildren(part)
-	for _, child := range children {
-		result := child.search(parts, height+1)
-		if result != nil {
-			return result
+	n := tree.root
+	for _, seg := range segments {
+		switch seg.nType {
+		case static:
+			n = n.insertStatic(seg.path)
+		case param:
+			if n.paramChild == nil {
+				n.paramChild = &node{path: seg.path, nType: param}
+			} else if n.paramChild.path != seg.path {
+				return fmt.Errorf("wildcard %v in path=%v conflicts with existing wildcard %v", seg.path, path, n.paramChild.path)
+			}
+			n = n.paramChild
+		case catchAll:
+			if n.catchAllChild == nil {
+				n.catchAllChild = &node{path: seg.path, nType: catchAll}
+			} else if n.catchAllChild.path != seg.path {
+				return fmt.Errorf("catch-all %v in path=%v conflicts with existing catch-all %v", seg.path, path, n.catchAllChild.path)
+			}
+			n = n.catchAllChild
 		}
 	}
+	if n.handlers != nil {
+		return fmt.Errorf("path=%v conflicts with existing route %v", path, n.pattern)
+	}
+	n.handlers = handlers
+	n.pattern = path
+	if paramCount > tree.maxParams {
+		tree.maxParams = paramCount
+	}
 	return nil
 }
 
-func (tree *Tree) AddRouter(path string, handler HandlerFunc) error {
+// setHandlers 替换已注册路由的处理链，路由不存在时返回false
+func (tree *Tree) setHandlers(path string, handlers []HandlerFunc) bool {
+	segments, _, err := splitPattern(path)
+	if err != nil {
+		return false
+	}
 	n := tree.root
-	if path[0] != '/' {
-		return fmt.Errorf("invalid path=%v", path)
-	}
-	parts := strings.Split(path[1:], "/")
-	for i, part := range parts {
-		var next *node
-		next = n.matchChild(part)
-		// 如果没有找到
-		if next == nil {
-			next = &node{
-				part:     part,
-				children: make([]*node, 0),
-			}
-			if len(part) > 0 {
-				next.isWild = part[0] == ':' || part[0] == '*'
-			}
-			n.children = append(n.children, next)
-			if i == len(parts)-1 || (len(part) > 0 && part[0] == '*') {
-				if i != len(parts)-1 {
-					return fmt.Errorf("invalid * position, path=%v", path)
+	for _, seg := range segments {
+		switch seg.nType {
+		case static:
+			for rest := seg.path; rest != "" && n != nil; {
+				i := strings.IndexByte(n.indices, rest[0])
+				if i < 0 || !strings.HasPrefix(rest, n.children[i].path) {
+					return false
 				}
-				next.isLast = true
-				next.handler = handler
-				next.pattern = path
-				break
+				n = n.children[i]
+				rest = rest[len(n.path):]
 			}
+		case param:
+			n = n.paramChild
+		case catchAll:
+			n = n.catchAllChild
+		}
+		if n == nil {
+			return false
 		}
-		n = next
 	}
-	return nil
+	if n.pattern != path {
+		return false
+	}
+	n.handlers = handlers
+	return true
 }
 
-func (n *node) matchNode(path string) (*node, error) {
-	parts := strings.SplitN(path, "/", 2)
-	part := parts[0]
-	if strings.HasPrefix(n.part, "*") {
-		return n, nil
+// match 在节点自身的path已经被消费后，匹配剩余的path
+// 依次尝试静态子节点、参数子节点和通配子节点，失败时回溯，因此结果与注册顺序无关
+func (n *node) match(path string, params *Params) *node {
+	if path == "" {
+		if n.handlers != nil {
+			return n
+		}
+		// "/assets/*filepath"可以匹配"/assets/"
+		if n.catchAllChild != nil {
+			if params != nil {
+				*params = append(*params, Param{Key: n.catchAllChild.path[1:]})
+			}
+			return n.catchAllChild
+		}
+		return nil
 	}
-	children := n.matchChildren(part)
-	if children == nil {
-		return nil, nil
+	if i := strings.IndexByte(n.indices, path[0]); i >= 0 {
+		child := n.children[i]
+		if strings.HasPrefix(path, child.path) {
+			if result := child.match(path[len(child.path):], params); result != nil {
+				return result
+			}
+		}
 	}
-	// 已经是最后一个节点
-	if len(parts) == 1 {
-		for _, child := range children {
-			if child.isLast {
-				return child, nil
+	if child := n.paramChild; child != nil {
+		end := strings.IndexByte(path, '/')
+		if end < 0 {
+			end = len(path)
+		}
+		if end > 0 {
+			if params != nil {
+				*params = append(*params, Param{Key: child.path[1:], Value: path[:end]})
+			}
+			if result := child.match(path[end:], params); result != nil {
+				return result
+			}
+			if params != nil {
+				*params = (*params)[:len(*params)-1]
 			}
 		}
-		return nil, nil
 	}
-	for _, child := range children {
-		if nodeMatch, err := child.matchNode(parts[1]); nodeMatch != nil || err != nil {
-			return nodeMatch, err
+	if child := n.catchAllChild; child != nil {
+		if params != nil {
+			*params = append(*params, Param{Key: child.path[1:], Value: path})
 		}
+		return child
 	}
-	return nil, nil
+	return nil
 }
 
-func (tree *Tree) SearchRouter(path string) (HandlerFunc, map[string]string) {
-	if path[0] != '/' {
-		return nil, nil //, fmt.Errorf("invalid path=%v", path)
+// Find 查找路由，匹配到的参数追加到params中
+// params的容量不小于MaxParams时查找过程不分配内存，params为nil时不提取参数
+func (tree *Tree) Find(path string, params *Params) ([]HandlerFunc, string) {
+	if path == "" || path[0] != '/' {
+		return nil, ""
 	}
-	searchParts := parsePattern(path)
-	node, err := tree.root.matchNode(path[1:])
-	if err != nil {
-		return nil, nil
+	n := tree.root.match(path, params)
+	if n == nil {
+		return nil, ""
 	}
-	if node == nil {
+	return n.handlers, n.pattern
+}
+
+// MaxParams 所有路由中参数个数的最大值
+func (tree *Tree) MaxParams() int {
+	return tree.maxParams
+}
+
+func (tree *Tree) SearchRouter(path string) ([]HandlerFunc, map[string]string) {
+	params := make(Params, 0, tree.maxParams)
+	handlers, _ := tree.Find(path, &params)
+	if handlers == nil {
 		return nil, nil
 	}
-	params := make(map[string]string) // 用于解析通配符
-	parts := parsePattern(node.pattern)
-	for index, part := range parts {
-		// 去除路由中的通配符，用来提取参数，比如":lang"输入路径为"username"时，需要在map中保存key为lang，value为username"
-		// 去除路由中的":"
-		if part[0] == ':' {
-			params[part[1:]] = searchParts[index]
-		}
-		// 去除路由中的"*"
-		if part[0] == '*' && len(part) > 1 {
-			params[part[1:]] = strings.Join(searchParts[index:], "/")
-			break
-		}
+	// 去除路由中的通配符，用来提取参数，比如":lang"输入路径为"username"时，需要在map中保存key为lang，value为username
+	result := make(map[string]string, len(params))
+	for _, p := range params {
+		result[p.Key] = p.Value
 	}
-	return node.handler, params
+	return handlers, result
 }
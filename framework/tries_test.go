@@ -5,6 +5,7 @@ import (
 	"github.com/sanity-io/litter"
 	c "github.com/smartystreets/goconvey/convey"
 	"net/http"
+	"strings"
 	"testing"
 )
 
@@ -12,9 +13,9 @@ func TestAddRouter(t *testing.T) {
 	c.Convey("test add router", t, func() {
 		url := "/v1/student/add"
 		tree := NewTree()
-		err := tree.AddRouter(url, func(c *Context) {
+		err := tree.AddRouter(url, []HandlerFunc{func(c *Context) {
 			fmt.Println("hello world")
-		})
+		}})
 		c.So(err, c.ShouldBeNil)
 		c.So(nodeString(tree.root), c.ShouldEqual, "/v1/student/add")
 	})
@@ -24,14 +25,14 @@ func TestSearchRouter(t *testing.T) {
 	c.Convey("test search router", t, func() {
 		url := "/v1/student/add"
 		tree := NewTree()
-		err := tree.AddRouter(url, func(c *Context) {
+		err := tree.AddRouter(url, []HandlerFunc{func(c *Context) {
 			fmt.Println("hello world")
-		})
+		}})
 		c.So(err, c.ShouldBeNil)
-		handler, _ := tree.SearchRouter(url)
-		c.So(handler, c.ShouldNotBeNil)
+		handlers, _ := tree.SearchRouter(url)
+		c.So(handlers, c.ShouldHaveLength, 1)
 		r, _ := http.NewRequest(http.MethodGet, "/v1", nil)
-		handler(newContext(nil, r))
+		handlers[0](newContext(nil, r))
 	})
 }
 
@@ -39,15 +40,15 @@ func TestDynamicRouter(t *testing.T) {
 	c.Convey("test dynamic router", t, func() {
 		url1 := "/v1/student/:name/age/age"
 		tree := NewTree()
-		err := tree.AddRouter(url1, func(c *Context) {
+		err := tree.AddRouter(url1, []HandlerFunc{func(c *Context) {
 			fmt.Println("student name")
-		})
+		}})
 		c.So(err, c.ShouldBeNil)
-		handler, params := tree.SearchRouter("/v1/student/tom/age/age")
-		c.So(handler, c.ShouldNotBeNil)
+		handlers, params := tree.SearchRouter("/v1/student/tom/age/age")
+		c.So(handlers, c.ShouldHaveLength, 1)
 		litter.Dump(params)
 		r, _ := http.NewRequest(http.MethodGet, "/v1", nil)
-		handler(newContext(nil, r))
+		handlers[0](newContext(nil, r))
 	})
 }
 
@@ -55,15 +56,15 @@ func TestNullRouter(t *testing.T) {
 	c.Convey("test null router", t, func() {
 		url := "/"
 		tree := NewTree()
-		err := tree.AddRouter(url, func(c *Context) {
+		err := tree.AddRouter(url, []HandlerFunc{func(c *Context) {
 			fmt.Println("student name")
-		})
+		}})
 		c.So(err, c.ShouldBeNil)
 		//c.So(nodeString(tree.root), c.ShouldEqual, "/")
-		handler, _ := tree.SearchRouter("/")
-		c.So(handler, c.ShouldNotBeNil)
+		handlers, _ := tree.SearchRouter("/")
+		c.So(handlers, c.ShouldHaveLength, 1)
 		r, _ := http.NewRequest(http.MethodGet, "/v1", nil)
-		handler(newContext(nil, r))
+		handlers[0](newContext(nil, r))
 	})
 }
 
@@ -71,15 +72,270 @@ func nodeString(node *node) string {
 	if node == nil {
 		return ""
 	}
-	path := node.part
-	if node.part != "" {
-		path = "/" + node.part
+	path := node.path
+	if len(node.children) > 0 {
+		path += nodeString(node.children[0])
 	}
-	for _, child := range node.children {
-		if child != nil {
-			path += nodeString(child)
+	return path
+}
+
+func TestRouterPriority(t *testing.T) {
+	c.Convey("test static over param over catch-all", t, func() {
+		tree := NewTree()
+		for _, url := range []string{"/user/:id/edit", "/user/*path", "/user/new", "/user/:id", "/user/new/profile"} {
+			c.So(tree.AddRouter(url, []HandlerFunc{func(c *Context) {}}), c.ShouldBeNil)
+		}
+		cases := []struct {
+			path    string
+			pattern string
+			params  Params
+		}{
+			{"/user/new", "/user/new", nil},
+			{"/user/42", "/user/:id", Params{{Key: "id", Value: "42"}}},
+			{"/user/new/edit", "/user/:id/edit", Params{{Key: "id", Value: "new"}}},
+			{"/user/new/profile", "/user/new/profile", nil},
+			{"/user/42/a/b", "/user/*path", Params{{Key: "path", Value: "42/a/b"}}},
+			{"/user/", "/user/*path", Params{{Key: "path", Value: ""}}},
+		}
+		for _, tc := range cases {
+			var params Params
+			handlers, pattern := tree.Find(tc.path, &params)
+			c.So(handlers, c.ShouldNotBeNil)
+			c.So(pattern, c.ShouldEqual, tc.pattern)
+			c.So(params, c.ShouldResemble, tc.params)
+		}
+		handlers, _ := tree.Find("/users", nil)
+		c.So(handlers, c.ShouldBeNil)
+	})
+}
+
+func TestRouterConflict(t *testing.T) {
+	c.Convey("test conflict detection", t, func() {
+		handlers := []HandlerFunc{func(c *Context) {}}
+		tree := NewTree()
+		c.So(tree.AddRouter("/user/:id", handlers), c.ShouldBeNil)
+		c.So(tree.AddRouter("/user/:id", handlers), c.ShouldNotBeNil)
+		c.So(tree.AddRouter("/user/:name/edit", handlers), c.ShouldNotBeNil)
+		c.So(tree.AddRouter("/files/*path", handlers), c.ShouldBeNil)
+		c.So(tree.AddRouter("/files/*name", handlers), c.ShouldNotBeNil)
+		c.So(tree.AddRouter("/files/*path/x", handlers), c.ShouldNotBeNil)
+		c.So(tree.AddRouter("/a:b", handlers), c.ShouldNotBeNil)
+		c.So(tree.AddRouter("/a/:", handlers), c.ShouldNotBeNil)
+		c.So(tree.AddRouter("/a/:x/:x", handlers), c.ShouldNotBeNil)
+		c.So(tree.AddRouter("no-slash", handlers), c.ShouldNotBeNil)
+		c.So(tree.AddRouter("/empty", nil), c.ShouldNotBeNil)
+	})
+}
+
+var benchRoutes = []string{
+	"/",
+	"/user/new",
+	"/user/:id",
+	"/user/:id/profile",
+	"/user/:id/repos/:repo",
+	"/repos/:owner/:repo/issues",
+	"/repos/:owner/:repo/pulls/:number",
+	"/orgs/:org/members",
+	"/search/repositories",
+	"/search/code",
+	"/assets/*filepath",
+	"/v1/student/add",
+	"/v1/student/list",
+	"/v1/teacher/add",
+}
+
+func newBenchTree(b *testing.B) *Tree {
+	tree := NewTree()
+	for _, route := range benchRoutes {
+		if err := tree.AddRouter(route, []HandlerFunc{func(c *Context) {}}); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return tree
+}
+
+func BenchmarkSearchRouterStatic(b *testing.B) {
+	tree := newBenchTree(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tree.SearchRouter("/v1/student/list")
+	}
+}
+
+func BenchmarkSearchRouterParam(b *testing.B) {
+	tree := newBenchTree(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tree.SearchRouter("/repos/hiholder/geex/pulls/42")
+	}
+}
+
+func BenchmarkSearchRouterCatchAll(b *testing.B) {
+	tree := newBenchTree(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tree.SearchRouter("/assets/css/geektutu.css")
+	}
+}
+
+func BenchmarkFindStatic(b *testing.B) {
+	tree := newBenchTree(b)
+	params := make(Params, 0, tree.MaxParams())
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		params = params[:0]
+		tree.Find("/v1/student/list", &params)
+	}
+}
+
+func BenchmarkFindParam(b *testing.B) {
+	tree := newBenchTree(b)
+	params := make(Params, 0, tree.MaxParams())
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		params = params[:0]
+		tree.Find("/repos/hiholder/geex/pulls/42", &params)
+	}
+}
+
+func BenchmarkFindCatchAll(b *testing.B) {
+	tree := newBenchTree(b)
+	params := make(Params, 0, tree.MaxParams())
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		params = params[:0]
+		tree.Find("/assets/css/geektutu.css", &params)
+	}
+}
+
+// legacyNode 改写为radix tree之前按"/"分段的trie，只用于对比基准测试
+type legacyNode struct {
+	pattern  string
+	part     string
+	children []*legacyNode
+	isWild   bool
+	isLast   bool
+	handlers []HandlerFunc
+}
+
+func (n *legacyNode) matchChild(part string) *legacyNode {
+	for _, child := range n.children {
+		if child.part == part || child.isWild {
+			return child
+		}
+	}
+	return nil
+}
+
+func (n *legacyNode) matchChildren(part string) []*legacyNode {
+	if len(n.children) == 0 {
+		return nil
+	}
+	nodeList := make([]*legacyNode, 0, len(n.children))
+	for _, child := range n.children {
+		if child.part == part || child.isWild {
+			nodeList = append(nodeList, child)
+		}
+	}
+	return nodeList
+}
+
+func (n *legacyNode) addRouter(path string, handlers []HandlerFunc) {
+	parts := strings.Split(path[1:], "/")
+	for i, part := range parts {
+		next := n.matchChild(part)
+		if next == nil {
+			next = &legacyNode{part: part}
+			if len(part) > 0 {
+				next.isWild = part[0] == ':' || part[0] == '*'
+			}
+			n.children = append(n.children, next)
+			if i == len(parts)-1 {
+				next.isLast = true
+				next.handlers = handlers
+				next.pattern = path
+				break
+			}
+		}
+		n = next
+	}
+}
+
+func (n *legacyNode) matchNode(path string) *legacyNode {
+	parts := strings.SplitN(path, "/", 2)
+	if strings.HasPrefix(n.part, "*") {
+		return n
+	}
+	children := n.matchChildren(parts[0])
+	if len(parts) == 1 {
+		for _, child := range children {
+			if child.isLast {
+				return child
+			}
+		}
+		return nil
+	}
+	for _, child := range children {
+		if nodeMatch := child.matchNode(parts[1]); nodeMatch != nil {
+			return nodeMatch
+		}
+	}
+	return nil
+}
+
+func (n *legacyNode) searchRouter(path string) ([]HandlerFunc, map[string]string) {
+	searchParts := parsePattern(path)
+	node := n.matchNode(path[1:])
+	if node == nil {
+		return nil, nil
+	}
+	params := make(map[string]string)
+	for index, part := range parsePattern(node.pattern) {
+		if part[0] == ':' {
+			params[part[1:]] = searchParts[index]
+		}
+		if part[0] == '*' && len(part) > 1 {
+			params[part[1:]] = strings.Join(searchParts[index:], "/")
 			break
 		}
 	}
-	return path
+	return node.handlers, params
+}
+
+func newLegacyBenchTree() *legacyNode {
+	root := &legacyNode{}
+	for _, route := range benchRoutes {
+		root.addRouter(route, []HandlerFunc{func(c *Context) {}})
+	}
+	return root
+}
+
+func benchmarkLegacySearchRouter(b *testing.B, path string) {
+	root := newLegacyBenchTree()
+	if handlers, _ := root.searchRouter(path); handlers == nil {
+		b.Fatalf("legacy trie: %s not found", path)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		root.searchRouter(path)
+	}
+}
+
+func BenchmarkLegacySearchRouterStatic(b *testing.B) {
+	benchmarkLegacySearchRouter(b, "/v1/student/list")
+}
+
+func BenchmarkLegacySearchRouterParam(b *testing.B) {
+	benchmarkLegacySearchRouter(b, "/repos/hiholder/geex/pulls/42")
+}
+
+func BenchmarkLegacySearchRouterCatchAll(b *testing.B) {
+	benchmarkLegacySearchRouter(b, "/assets/css/geektutu.css")
 }
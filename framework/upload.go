@@ -0,0 +1,200 @@
+package framework
+
+import (
+	"bytes"
+	gerrors "github.com/pkg/errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// defaultMultipartMemory 解析multipart表单时默认保存在内存中的最大字节数
+const defaultMultipartMemory = 32 << 20
+
+// partHeaderSlack 流式检查单个part大小时为part的头部预留的字节数
+const partHeaderSlack = 8 << 10
+
+// ErrFileTooLarge 上传文件超过了Engine设置的单文件大小限制
+var ErrFileTooLarge = gerrors.New("upload file too large")
+
+// SetMaxMultipartMemory 设置解析multipart表单时保存在内存中的最大字节数，超出部分写入临时文件
+func (e *Engine) SetMaxMultipartMemory(size int64) {
+	e.maxMultipartMemory = size
+}
+
+// SetMaxUploadFileSize 设置单个上传文件的最大字节数，0表示不限制
+func (e *Engine) SetMaxUploadFileSize(size int64) {
+	e.maxUploadFileSize = size
+}
+
+// parseForm 按需解析请求体，只解析一次
+// urlencoded和multipart表单的字段都会填充到Req.PostForm和Req.Form中
+func (c *Context) parseForm() error {
+	if c.ContentType() == MIMEMultipartPOSTForm {
+		if c.Req.MultipartForm != nil {
+			return nil
+		}
+		maxMemory := int64(defaultMultipartMemory)
+		if c.engine != nil {
+			maxMemory = c.engine.maxMultipartMemory
+		}
+		limited := c.limitParts()
+		err := c.Req.ParseMultipartForm(maxMemory)
+		if limited != nil && limited.exceeded {
+			return gerrors.Wrapf(ErrFileTooLarge, "limit=%d", c.engine.maxUploadFileSize)
+		}
+		return err
+	}
+	if c.Req.PostForm != nil {
+		return nil
+	}
+	return c.Req.ParseForm()
+}
+
+// limitParts 设置了单文件大小限制时，在读取请求体的同时检查每个part的大小
+// 超出限制时立即停止读取，不会把整个请求体写入临时文件后才发现
+func (c *Context) limitParts() *partLimitReader {
+	if c.engine == nil || c.engine.maxUploadFileSize <= 0 || c.Req.Body == nil {
+		return nil
+	}
+	_, params, err := mime.ParseMediaType(c.Req.Header.Get("Content-Type"))
+	if err != nil || params["boundary"] == "" {
+		return nil
+	}
+	r := &partLimitReader{
+		ReadCloser: c.Req.Body,
+		delim:      []byte("\r\n--" + params["boundary"]),
+		limit:      c.engine.maxUploadFileSize + partHeaderSlack,
+	}
+	c.Req.Body = r
+	return r
+}
+
+// partLimitReader 统计请求体中两个分隔符之间的字节数，超过limit时返回错误
+// 统计包括part的头部，精确的文件大小仍由checkFileSize检查
+type partLimitReader struct {
+	io.ReadCloser
+	delim    []byte
+	limit    int64
+	size     int64  // 当前part已经读取的字节数
+	tail     []byte // 上一次读取的最后len(delim)-1个字节，用于查找跨越两次读取的分隔符
+	buf      []byte
+	exceeded bool
+}
+
+func (r *partLimitReader) Read(p []byte) (int, error) {
+	if r.exceeded {
+		return 0, ErrFileTooLarge
+	}
+	n, err := r.ReadCloser.Read(p)
+	chunk := p[:n]
+	keep := len(r.delim) - 1
+	if i := bytes.LastIndex(chunk, r.delim); i >= 0 {
+		r.size = int64(n - i - len(r.delim))
+	} else {
+		head := chunk
+		if len(head) > keep {
+			head = head[:keep]
+		}
+		r.buf = append(append(r.buf[:0], r.tail...), head...)
+		if i := bytes.LastIndex(r.buf, r.delim); i >= 0 {
+			r.size = int64(len(r.buf)-i-len(r.delim)) + int64(n-len(head))
+		} else {
+			r.size += int64(n)
+		}
+	}
+	if n >= keep {
+		r.tail = append(r.tail[:0], chunk[n-keep:]...)
+	} else {
+		r.buf = append(append(r.buf[:0], r.tail...), chunk...)
+		if len(r.buf) > keep {
+			r.buf = r.buf[len(r.buf)-keep:]
+		}
+		r.tail = append(r.tail[:0], r.buf...)
+	}
+	if r.size > r.limit {
+		r.exceeded = true
+		return n, ErrFileTooLarge
+	}
+	return n, err
+}
+
+// MultipartForm 解析后的multipart表单，包括上传的文件
+func (c *Context) MultipartForm() (*multipart.Form, error) {
+	if err := c.parseForm(); err != nil {
+		return nil, err
+	}
+	if c.Req.MultipartForm == nil {
+		return nil, http.ErrNotMultipart
+	}
+	for _, fhs := range c.Req.MultipartForm.File {
+		for _, fh := range fhs {
+			if err := c.checkFileSize(fh); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return c.Req.MultipartForm, nil
+}
+
+// FormFile 获取表单中name对应的第一个文件
+func (c *Context) FormFile(name string) (*multipart.FileHeader, error) {
+	if err := c.parseForm(); err != nil {
+		return nil, err
+	}
+	if c.Req.MultipartForm == nil {
+		return nil, http.ErrNotMultipart
+	}
+	fhs := c.Req.MultipartForm.File[name]
+	if len(fhs) == 0 {
+		return nil, http.ErrMissingFile
+	}
+	if err := c.checkFileSize(fhs[0]); err != nil {
+		return nil, err
+	}
+	return fhs[0], nil
+}
+
+func (c *Context) checkFileSize(fh *multipart.FileHeader) error {
+	if c.engine == nil || c.engine.maxUploadFileSize <= 0 || fh.Size <= c.engine.maxUploadFileSize {
+		return nil
+	}
+	return gerrors.Wrapf(ErrFileTooLarge, "file %s size=%d, limit=%d", fh.Filename, fh.Size, c.engine.maxUploadFileSize)
+}
+
+// SaveUploadedFile 将上传的文件以流的方式保存到dst，目录不存在时自动创建
+func (c *Context) SaveUploadedFile(fh *multipart.FileHeader, dst string) error {
+	src, err := fh.Open()
+	if err != nil {
+		return gerrors.WithStack(err)
+	}
+	defer src.Close()
+	if err = os.MkdirAll(filepath.Dir(dst), 0750); err != nil {
+		return gerrors.WithStack(err)
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return gerrors.WithStack(err)
+	}
+	defer out.Close()
+	_, err = io.Copy(out, src)
+	return gerrors.WithStack(err)
+}
+
+// SniffContentType 根据文件内容的前512个字节判断文件类型，不依赖客户端提供的Content-Type
+func (c *Context) SniffContentType(fh *multipart.FileHeader) (string, error) {
+	f, err := fh.Open()
+	if err != nil {
+		return "", gerrors.WithStack(err)
+	}
+	defer f.Close()
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", gerrors.WithStack(err)
+	}
+	return http.DetectContentType(buf[:n]), nil
+}
@@ -0,0 +1,153 @@
+package framework
+
+import (
+	"bytes"
+	gerrors "github.com/pkg/errors"
+	c "github.com/smartystreets/goconvey/convey"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func newUploadRequest(fields map[string]string, files map[string]string) *http.Request {
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	for k, v := range fields {
+		mw.WriteField(k, v)
+	}
+	for name, content := range files {
+		fw, _ := mw.CreateFormFile(name, name+".txt")
+		fw.Write([]byte(content))
+	}
+	mw.Close()
+	r := httptest.NewRequest(http.MethodPost, "/upload", body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	return r
+}
+
+// countingBody 记录请求体被读取的字节数
+type countingBody struct {
+	r io.ReadCloser
+	n int
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	b.n += n
+	return n, err
+}
+
+func (b *countingBody) Close() error { return b.r.Close() }
+
+func TestUpload(t *testing.T) {
+	c.Convey("test multipart upload", t, func() {
+		engine := New()
+		engine.SetMaxMultipartMemory(16)
+		engine.SetMaxUploadFileSize(64)
+		dir := t.TempDir()
+		engine.Post("/upload", func(ctx *Context) {
+			age, _ := ctx.FormInt("age", 0)
+			fh, err := ctx.FormFile("doc")
+			if err != nil {
+				ctx.Fail(http.StatusBadRequest, err.Error())
+				return
+			}
+			contentType, _ := ctx.SniffContentType(fh)
+			if err = ctx.SaveUploadedFile(fh, filepath.Join(dir, "sub", fh.Filename)); err != nil {
+				ctx.Fail(http.StatusInternalServerError, err.Error())
+				return
+			}
+			ctx.String(http.StatusOK, "%d %s %s", age, ctx.PostForm("name"), contentType)
+		})
+
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, newUploadRequest(map[string]string{"age": "18", "name": "geex"}, map[string]string{"doc": "hello upload"}))
+		c.So(w.Code, c.ShouldEqual, http.StatusOK)
+		c.So(w.Body.String(), c.ShouldEqual, "18 geex text/plain; charset=utf-8")
+		saved, err := os.ReadFile(filepath.Join(dir, "sub", "doc.txt"))
+		c.So(err, c.ShouldBeNil)
+		c.So(string(saved), c.ShouldEqual, "hello upload")
+
+		w = httptest.NewRecorder()
+		engine.ServeHTTP(w, newUploadRequest(nil, map[string]string{"doc": strings.Repeat("x", 100)}))
+		c.So(w.Code, c.ShouldEqual, http.StatusBadRequest)
+		c.So(w.Body.String(), c.ShouldContainSubstring, ErrFileTooLarge.Error())
+
+		// 超出限制时停止读取请求体
+		r := newUploadRequest(nil, map[string]string{"doc": strings.Repeat("x", 1<<20)})
+		body := &countingBody{r: r.Body}
+		r.Body = body
+		w = httptest.NewRecorder()
+		engine.ServeHTTP(w, r)
+		c.So(w.Code, c.ShouldEqual, http.StatusBadRequest)
+		c.So(w.Body.String(), c.ShouldContainSubstring, ErrFileTooLarge.Error())
+		c.So(body.n, c.ShouldBeLessThan, 128<<10)
+	})
+
+	c.Convey("test part limit across small reads", t, func() {
+		engine := New()
+		engine.SetMaxUploadFileSize(partHeaderSlack)
+		files := map[string]string{"a": strings.Repeat("a", partHeaderSlack), "b": strings.Repeat("b", partHeaderSlack)}
+		r := newUploadRequest(nil, files)
+		r.Body = io.NopCloser(iotest.OneByteReader(r.Body))
+		ctx := newContext(httptest.NewRecorder(), r)
+		ctx.engine = engine
+		form, err := ctx.MultipartForm()
+		c.So(err, c.ShouldBeNil)
+		c.So(form.File, c.ShouldHaveLength, 2)
+
+		files["c"] = strings.Repeat("c", 3*partHeaderSlack)
+		r = newUploadRequest(nil, files)
+		r.Body = io.NopCloser(iotest.OneByteReader(r.Body))
+		ctx = newContext(httptest.NewRecorder(), r)
+		ctx.engine = engine
+		_, err = ctx.MultipartForm()
+		c.So(gerrors.Is(err, ErrFileTooLarge), c.ShouldBeTrue)
+	})
+
+	c.Convey("test multipart temp files are removed behind WithContext middlewares", t, func() {
+		dir := t.TempDir()
+		t.Setenv("TMPDIR", dir)
+		engine := New()
+		engine.SetMaxMultipartMemory(16)
+		engine.Use(RequestID(), Timeout(time.Second, nil))
+		// Timeout在其他goroutine中执行处理链，不能在其中断言
+		var tmpFiles int
+		engine.Post("/upload", func(ctx *Context) {
+			if _, err := ctx.FormFile("doc"); err != nil {
+				ctx.Fail(http.StatusBadRequest, err)
+				return
+			}
+			entries, _ := os.ReadDir(dir)
+			tmpFiles = len(entries)
+			ctx.Status(http.StatusNoContent)
+		})
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, newUploadRequest(nil, map[string]string{"doc": strings.Repeat("x", 1024)}))
+		c.So(w.Code, c.ShouldEqual, http.StatusNoContent)
+		c.So(tmpFiles, c.ShouldEqual, 1)
+		entries, err := os.ReadDir(dir)
+		c.So(err, c.ShouldBeNil)
+		c.So(entries, c.ShouldBeEmpty)
+	})
+
+	c.Convey("test urlencoded form is parsed lazily", t, func() {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("age=20&name=geex"))
+		r.Header.Set("Content-Type", MIMEPOSTForm)
+		ctx := newContext(httptest.NewRecorder(), r)
+		age, ok := ctx.FormInt("age", 0)
+		c.So(ok, c.ShouldBeTrue)
+		c.So(age, c.ShouldEqual, 20)
+		name, _ := ctx.FormString("name", "")
+		c.So(name, c.ShouldEqual, "geex")
+		_, err := ctx.FormFile("doc")
+		c.So(err, c.ShouldEqual, http.ErrNotMultipart)
+	})
+}
@@ -0,0 +1,113 @@
+package framework
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// nameRoute 记录命名路由，同一个名字只能使用一次
+func (e *Engine) nameRoute(name string, route *Route) error {
+	if name == "" {
+		return fmt.Errorf("route name must not be empty, path=%v", route.pattern)
+	}
+	if exist, ok := e.namedRoutes[name]; ok {
+		return fmt.Errorf("route name %q of %v %v already used by %v %v", name, route.method, route.pattern, exist.method, exist.pattern)
+	}
+	e.namedRoutes[name] = route
+	return nil
+}
+
+// URL 根据路由名生成URL，params需要包含路由中全部的:param参数，*catchall参数可以省略
+// 参数会按路径段转义，query不为空时追加为查询字符串
+// 路由匹配的是解码后的路径，:param参数中的"/"转义后仍会被当作分隔符，因此返回错误
+func (e *Engine) URL(name string, params map[string]string, query url.Values) (string, error) {
+	route, ok := e.namedRoutes[name]
+	if !ok {
+		return "", fmt.Errorf("route %q not found", name)
+	}
+	segments, _, err := splitPattern(route.pattern)
+	if err != nil {
+		return "", err
+	}
+	var (
+		b    strings.Builder
+		used int
+	)
+	for _, seg := range segments {
+		switch seg.nType {
+		case static:
+			b.WriteString(seg.path)
+		case param:
+			key := seg.path[1:]
+			v := params[key]
+			if v == "" {
+				return "", fmt.Errorf("missing param %q for route %q(%v)", key, name, route.pattern)
+			}
+			if strings.Contains(v, "/") {
+				return "", fmt.Errorf("param %q of route %q(%v) must not contain '/': %q", key, name, route.pattern, v)
+			}
+			b.WriteString(url.PathEscape(v))
+			used++
+		case catchAll:
+			v, ok := params[seg.path[1:]]
+			if !ok {
+				continue
+			}
+			parts := strings.Split(strings.TrimPrefix(v, "/"), "/")
+			for i, part := range parts {
+				parts[i] = url.PathEscape(part)
+			}
+			b.WriteString(strings.Join(parts, "/"))
+			used++
+		}
+	}
+	if used != len(params) {
+		for key := range params {
+			if !hasWildcard(segments, key) {
+				return "", fmt.Errorf("unknown param %q for route %q(%v)", key, name, route.pattern)
+			}
+		}
+	}
+	if len(query) > 0 {
+		b.WriteString("?")
+		b.WriteString(query.Encode())
+	}
+	return b.String(), nil
+}
+
+func hasWildcard(segments []segment, key string) bool {
+	for _, seg := range segments {
+		if seg.nType != static && seg.path[1:] == key {
+			return true
+		}
+	}
+	return false
+}
+
+// urlFunc 模板函数url，用法: {{ url "user.show" "name" .Name }}
+// 参数为路由名和若干key/value对，不属于路由参数的key作为查询参数
+func (e *Engine) urlFunc(name string, pairs ...interface{}) (string, error) {
+	if len(pairs)%2 != 0 {
+		return "", fmt.Errorf("url %q: params must be key/value pairs", name)
+	}
+	route, ok := e.namedRoutes[name]
+	if !ok {
+		return "", fmt.Errorf("route %q not found", name)
+	}
+	segments, _, err := splitPattern(route.pattern)
+	if err != nil {
+		return "", err
+	}
+	params := make(map[string]string)
+	query := url.Values{}
+	for i := 0; i < len(pairs); i += 2 {
+		key, value := fmt.Sprint(pairs[i]), fmt.Sprint(pairs[i+1])
+		if hasWildcard(segments, key) {
+			params[key] = value
+		} else {
+			query.Add(key, value)
+		}
+	}
+	return e.URL(name, params, query)
+}
@@ -0,0 +1,75 @@
+package framework
+
+import (
+	"bytes"
+	c "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestURL(t *testing.T) {
+	c.Convey("test reverse routing", t, func() {
+		engine := New()
+		handler := func(ctx *Context) {}
+		engine.Get("/hello/:name", handler).Name("hello")
+		engine.Group("/v1").Get("/user/:id/files/*path", handler).Name("user.files")
+
+		u, err := engine.URL("hello", map[string]string{"name": "a b?c"}, url.Values{"lang": {"zh"}})
+		c.So(err, c.ShouldBeNil)
+		c.So(u, c.ShouldEqual, "/hello/a%20b%3Fc?lang=zh")
+		// 解码后的"/"会被路由当作分隔符，生成的URL无法匹配
+		_, err = engine.URL("hello", map[string]string{"name": "a/b"}, nil)
+		c.So(err, c.ShouldNotBeNil)
+
+		u, err = engine.URL("user.files", map[string]string{"id": "7", "path": "docs/read me.md"}, nil)
+		c.So(err, c.ShouldBeNil)
+		c.So(u, c.ShouldEqual, "/v1/user/7/files/docs/read%20me.md")
+
+		_, err = engine.URL("hello", nil, nil)
+		c.So(err, c.ShouldNotBeNil)
+		_, err = engine.URL("hello", map[string]string{"name": "a", "id": "1"}, nil)
+		c.So(err, c.ShouldNotBeNil)
+		_, err = engine.URL("missing", nil, nil)
+		c.So(err, c.ShouldNotBeNil)
+		c.So(engine.nameRoute("hello", &Route{method: "GET", pattern: "/hi"}), c.ShouldNotBeNil)
+	})
+
+	c.Convey("test generated urls route back to the same params", t, func() {
+		engine := New()
+		handler := func(ctx *Context) {
+			ctx.String(http.StatusOK, "%s|%s", ctx.Param("name"), ctx.Param("path"))
+		}
+		engine.Get("/hello/:name", handler).Name("hello")
+		engine.Get("/files/*path", handler).Name("files")
+		serve := func(u string) string {
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, u, nil))
+			c.So(w.Code, c.ShouldEqual, http.StatusOK)
+			return w.Body.String()
+		}
+
+		u, err := engine.URL("hello", map[string]string{"name": "a b?c#d%e"}, nil)
+		c.So(err, c.ShouldBeNil)
+		c.So(serve(u), c.ShouldEqual, "a b?c#d%e|")
+		u, err = engine.URL("files", map[string]string{"path": "docs/read me.md"}, nil)
+		c.So(err, c.ShouldBeNil)
+		c.So(serve(u), c.ShouldEqual, "|docs/read me.md")
+	})
+
+	c.Convey("test url template func", t, func() {
+		engine := New()
+		engine.Get("/hello/:name", func(ctx *Context) {}).Name("hello")
+		dir := t.TempDir()
+		tmpl := `{{ url "hello" "name" .Name "page" 2 }}`
+		c.So(os.WriteFile(filepath.Join(dir, "url.tmpl"), []byte(tmpl), 0644), c.ShouldBeNil)
+		engine.LoadHTMLGlob(filepath.Join(dir, "*.tmpl"))
+		var buf bytes.Buffer
+		err := engine.htmlTemplates.ExecuteTemplate(&buf, "url.tmpl", H{"Name": "geex"})
+		c.So(err, c.ShouldBeNil)
+		c.So(buf.String(), c.ShouldEqual, "/hello/geex?page=2")
+	})
+}
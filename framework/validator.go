@@ -0,0 +1,256 @@
+package framework
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// FieldError 单个字段的校验错误
+type FieldError struct {
+	Field   string `json:"field"`           // 字段名，取绑定时使用的标签名，嵌套字段用"."连接
+	Rule    string `json:"rule"`            // 未通过的规则
+	Param   string `json:"param,omitempty"` // 规则参数
+	Message string `json:"message"`
+}
+
+// ValidationErrors 结构体校验失败的字段错误列表
+type ValidationErrors []FieldError
+
+func (ve ValidationErrors) Error() string {
+	messages := make([]string, 0, len(ve))
+	for _, fe := range ve {
+		messages = append(messages, fe.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// 编译后的regexp规则缓存
+var regexpCache sync.Map
+
+// Validate 按validate标签校验结构体，字段名取json标签
+// 支持的规则: required, min=n, max=n, len=n, oneof=a b c, email, regexp=pattern
+// 规则之间用","分隔，regexp需要放在最后，其后的内容全部作为正则表达式
+// 非required字段为零值时跳过其余规则
+func Validate(obj interface{}) error {
+	return validate(obj, "json")
+}
+
+func validate(obj interface{}, nameTag string) error {
+	rv := reflect.ValueOf(obj)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+	var errs ValidationErrors
+	validateStruct(rv, "", nameTag, &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func validateStruct(rv reflect.Value, prefix, nameTag string, errs *ValidationErrors) {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		if sf.PkgPath != "" && !sf.Anonymous {
+			continue
+		}
+		name := strings.Split(sf.Tag.Get(nameTag), ",")[0]
+		if name == "-" {
+			continue
+		}
+		field := prefix
+		// 匿名嵌入且没有标签的结构体，字段展开到外层
+		if !(sf.Anonymous && name == "") {
+			if name == "" {
+				name = sf.Name
+			}
+			field = joinField(prefix, name)
+		}
+		fv := rv.Field(i)
+		if rules := sf.Tag.Get("validate"); rules != "" && rules != "-" {
+			validateField(fv, field, rules, errs)
+		}
+		for fv.Kind() == reflect.Ptr && !fv.IsNil() {
+			fv = fv.Elem()
+		}
+		switch {
+		case fv.Kind() == reflect.Struct && fv.Type() != timeType:
+			validateStruct(fv, field, nameTag, errs)
+		case fv.Kind() == reflect.Slice || fv.Kind() == reflect.Array:
+			if !isNestedStruct(fv.Type().Elem()) {
+				continue
+			}
+			for j := 0; j < fv.Len(); j++ {
+				elem := fv.Index(j)
+				if elem.Kind() == reflect.Ptr {
+					if elem.IsNil() {
+						continue
+					}
+					elem = elem.Elem()
+				}
+				validateStruct(elem, fmt.Sprintf("%s[%d]", field, j), nameTag, errs)
+			}
+		}
+	}
+}
+
+func joinField(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+type rule struct {
+	name  string
+	param string
+}
+
+func parseRules(tag string) []rule {
+	var rules []rule
+	for tag != "" {
+		var part string
+		if strings.HasPrefix(tag, "regexp=") {
+			part, tag = tag, ""
+		} else if i := strings.IndexByte(tag, ','); i >= 0 {
+			part, tag = tag[:i], tag[i+1:]
+		} else {
+			part, tag = tag, ""
+		}
+		name, param := part, ""
+		if i := strings.IndexByte(part, '='); i >= 0 {
+			name, param = part[:i], part[i+1:]
+		}
+		rules = append(rules, rule{name: strings.TrimSpace(name), param: param})
+	}
+	return rules
+}
+
+func validateField(fv reflect.Value, field, tag string, errs *ValidationErrors) {
+	rules := parseRules(tag)
+	required := false
+	for _, r := range rules {
+		if r.name == "required" {
+			required = true
+		}
+	}
+	for fv.Kind() == reflect.Ptr && !fv.IsNil() {
+		fv = fv.Elem()
+	}
+	if isEmptyValue(fv) {
+		if required {
+			*errs = append(*errs, FieldError{Field: field, Rule: "required", Message: field + " is required"})
+		}
+		return
+	}
+	for _, r := range rules {
+		if r.name == "required" {
+			continue
+		}
+		if msg, ok := checkRule(fv, field, r); !ok {
+			*errs = append(*errs, FieldError{Field: field, Rule: r.name, Param: r.param, Message: msg})
+		}
+	}
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	default:
+		return v.IsZero()
+	}
+}
+
+// checkRule 校验单条规则，规则配置错误属于开发期错误，直接panic
+func checkRule(v reflect.Value, field string, r rule) (string, bool) {
+	switch r.name {
+	case "min", "max", "len":
+		limit, err := strconv.ParseFloat(r.param, 64)
+		if err != nil {
+			panic(fmt.Sprintf("validate: invalid param %q of rule %s on %s", r.param, r.name, field))
+		}
+		size, isLen := measure(v, field, r.name)
+		unit := ""
+		if isLen {
+			unit = " in length"
+		}
+		switch r.name {
+		case "min":
+			return fmt.Sprintf("%s must be at least %s%s", field, r.param, unit), size >= limit
+		case "max":
+			return fmt.Sprintf("%s must be at most %s%s", field, r.param, unit), size <= limit
+		default:
+			if !isLen {
+				panic(fmt.Sprintf("validate: rule len not supported on %s of type %v", field, v.Type()))
+			}
+			return fmt.Sprintf("%s must be %s in length", field, r.param), size == limit
+		}
+	case "oneof":
+		options := strings.Fields(r.param)
+		value := fmt.Sprint(v.Interface())
+		for _, option := range options {
+			if option == value {
+				return "", true
+			}
+		}
+		return fmt.Sprintf("%s must be one of [%s]", field, strings.Join(options, " ")), false
+	case "email":
+		s := stringValue(v, field, r.name)
+		addr, err := mail.ParseAddress(s)
+		return fmt.Sprintf("%s must be a valid email address", field), err == nil && addr.Address == s
+	case "regexp":
+		return fmt.Sprintf("%s must match %s", field, r.param), compileRegexp(r.param).MatchString(stringValue(v, field, r.name))
+	default:
+		panic(fmt.Sprintf("validate: unknown rule %q on %s", r.name, field))
+	}
+}
+
+// measure 数字取值本身，字符串取字符数，切片和map取长度
+func measure(v reflect.Value, field, name string) (float64, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), true
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return float64(v.Len()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), false
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), false
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), false
+	default:
+		panic(fmt.Sprintf("validate: rule %s not supported on %s of type %v", name, field, v.Type()))
+	}
+}
+
+func stringValue(v reflect.Value, field, name string) string {
+	if v.Kind() != reflect.String {
+		panic(fmt.Sprintf("validate: rule %s not supported on %s of type %v", name, field, v.Type()))
+	}
+	return v.String()
+}
+
+func compileRegexp(pattern string) *regexp.Regexp {
+	if re, ok := regexpCache.Load(pattern); ok {
+		return re.(*regexp.Regexp)
+	}
+	re := regexp.MustCompile(pattern)
+	regexpCache.Store(pattern, re)
+	return re
+}
@@ -0,0 +1,128 @@
+package framework
+
+import (
+	"bufio"
+	gerrors "github.com/pkg/errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+)
+
+// noWritten 响应头还未写出时size的取值
+const noWritten = -1
+
+// ResponseWriter 对http.ResponseWriter的封装，记录状态码和写出的字节数
+// 状态码在第一次写响应体或调用WriteHeaderNow时才真正写出，之前可以被覆盖
+type ResponseWriter interface {
+	http.ResponseWriter
+	http.Flusher
+	http.Hijacker
+	http.Pusher
+	io.StringWriter
+	// Status 响应状态码
+	Status() int
+	// Size 已经写出的响应体字节数，响应头未写出时为-1
+	Size() int
+	// Written 响应头是否已经写出
+	Written() bool
+	// WriteHeaderNow 立即写出响应头
+	WriteHeaderNow()
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+var _ ResponseWriter = &responseWriter{}
+
+func newResponseWriter(w http.ResponseWriter) *responseWriter {
+	rw := &responseWriter{}
+	rw.reset(w)
+	return rw
+}
+
+func (w *responseWriter) reset(writer http.ResponseWriter) {
+	w.ResponseWriter = writer
+	w.status = http.StatusOK
+	w.size = noWritten
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	if code <= 0 || w.status == code {
+		return
+	}
+	if w.Written() {
+		log.Printf("[geex] WARNING: headers were already written, wanted to override status code %d with %d", w.status, code)
+		return
+	}
+	w.status = code
+}
+
+func (w *responseWriter) WriteHeaderNow() {
+	if !w.Written() {
+		w.size = 0
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+}
+
+func (w *responseWriter) Write(data []byte) (int, error) {
+	w.WriteHeaderNow()
+	n, err := w.ResponseWriter.Write(data)
+	w.size += n
+	return n, err
+}
+
+func (w *responseWriter) WriteString(s string) (int, error) {
+	w.WriteHeaderNow()
+	n, err := io.WriteString(w.ResponseWriter, s)
+	w.size += n
+	return n, err
+}
+
+func (w *responseWriter) Status() int {
+	return w.status
+}
+
+func (w *responseWriter) Size() int {
+	return w.size
+}
+
+func (w *responseWriter) Written() bool {
+	return w.size != noWritten
+}
+
+// Hijack 接管底层连接，例如websocket升级，之后不再写出响应头
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, gerrors.New("http.ResponseWriter does not implement http.Hijacker")
+	}
+	conn, rw, err := hj.Hijack()
+	// 接管失败时仍然可以正常写出错误响应
+	if err == nil && w.size < 0 {
+		w.size = 0
+	}
+	return conn, rw, err
+}
+
+func (w *responseWriter) Flush() {
+	w.WriteHeaderNow()
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *responseWriter) Push(target string, opts *http.PushOptions) error {
+	if pusher, ok := w.ResponseWriter.(http.Pusher); ok {
+		return pusher.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// Unwrap 返回原始的http.ResponseWriter，供http.ResponseController使用
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
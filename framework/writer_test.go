@@ -0,0 +1,87 @@
+package framework
+
+import (
+	"bufio"
+	c "github.com/smartystreets/goconvey/convey"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type hijackRecorder struct {
+	*httptest.ResponseRecorder
+	hijacked bool
+	err      error
+}
+
+func (h *hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h.err != nil {
+		return nil, nil, h.err
+	}
+	h.hijacked = true
+	return nil, nil, nil
+}
+
+func TestResponseWriter(t *testing.T) {
+	c.Convey("test status, size and written state", t, func() {
+		rec := httptest.NewRecorder()
+		w := newResponseWriter(rec)
+		c.So(w.Written(), c.ShouldBeFalse)
+		c.So(w.Size(), c.ShouldEqual, noWritten)
+		w.WriteHeader(http.StatusCreated)
+		w.WriteHeader(http.StatusAccepted)
+		c.So(w.Written(), c.ShouldBeFalse)
+		n, _ := w.WriteString("hello")
+		c.So(n, c.ShouldEqual, 5)
+		w.WriteHeader(http.StatusInternalServerError)
+		c.So(w.Status(), c.ShouldEqual, http.StatusAccepted)
+		c.So(w.Size(), c.ShouldEqual, 5)
+		c.So(rec.Code, c.ShouldEqual, http.StatusAccepted)
+		w.Flush()
+		c.So(rec.Flushed, c.ShouldBeTrue)
+		c.So(w.Push("/a.css", nil), c.ShouldEqual, http.ErrNotSupported)
+	})
+
+	c.Convey("test hijack", t, func() {
+		_, _, err := newResponseWriter(httptest.NewRecorder()).Hijack()
+		c.So(err, c.ShouldNotBeNil)
+		rec := &hijackRecorder{ResponseRecorder: httptest.NewRecorder()}
+		w := newResponseWriter(rec)
+		_, _, err = w.Hijack()
+		c.So(err, c.ShouldBeNil)
+		c.So(rec.hijacked, c.ShouldBeTrue)
+		c.So(w.Written(), c.ShouldBeTrue)
+
+		// 接管失败时没有写出任何内容
+		rec = &hijackRecorder{ResponseRecorder: httptest.NewRecorder(), err: http.ErrHijacked}
+		w = newResponseWriter(rec)
+		_, _, err = w.Hijack()
+		c.So(err, c.ShouldEqual, http.ErrHijacked)
+		c.So(w.Written(), c.ShouldBeFalse)
+	})
+
+	c.Convey("test status recorded for data and status only handlers", t, func() {
+		engine := New()
+		var status, size int
+		engine.Use(func(ctx *Context) {
+			ctx.Next()
+			status, size = ctx.Writer.Status(), ctx.Writer.Size()
+		})
+		engine.Get("/data", func(ctx *Context) {
+			ctx.Data(http.StatusAccepted, []byte("abc"))
+		})
+		engine.Get("/status", func(ctx *Context) {
+			ctx.AbortWithStatus(http.StatusUnauthorized)
+		})
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/data", nil))
+		c.So(status, c.ShouldEqual, http.StatusAccepted)
+		c.So(size, c.ShouldEqual, 3)
+
+		w = httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/status", nil))
+		c.So(w.Code, c.ShouldEqual, http.StatusUnauthorized)
+		c.So(status, c.ShouldEqual, http.StatusUnauthorized)
+	})
+}
@@ -3,6 +3,7 @@ module github.com/hiholder/geex
 go 1.16
 
 require (
+	github.com/andybalholm/brotli v1.0.4
 	github.com/fsnotify/fsnotify v1.6.0
 	github.com/jonboulle/clockwork v0.4.0 // indirect
 	github.com/json-iterator/go v1.1.12
@@ -15,6 +16,7 @@ require (
 	github.com/sirupsen/logrus v1.9.0
 	github.com/smartystreets/goconvey v1.7.2
 	github.com/spf13/cast v1.5.0
+	golang.org/x/net v0.4.0
 	golang.org/x/time v0.2.0
 	gopkg.in/yaml.v3 v3.0.1
 )